@@ -7,12 +7,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/konghanghang/openlist-strm/internal/alist"
 	"github.com/konghanghang/openlist-strm/internal/api"
 	"github.com/konghanghang/openlist-strm/internal/config"
 	"github.com/konghanghang/openlist-strm/internal/logger"
 	"github.com/konghanghang/openlist-strm/internal/scheduler"
+	"github.com/konghanghang/openlist-strm/internal/secrets"
 	"github.com/konghanghang/openlist-strm/internal/storage"
 	"github.com/konghanghang/openlist-strm/internal/strm"
 	"github.com/konghanghang/openlist-strm/internal/web"
@@ -63,6 +65,13 @@ func main() {
 	}()
 	logger.Info.Printf("Database initialized: %s", cfg.Database.Path)
 
+	// Open the key used to encrypt secrets stored in the database
+	box, err := secrets.Open(cfg.Security.SecretKey, cfg.Security.KeyFile)
+	if err != nil {
+		logger.Error.Printf("Failed to initialize secret store: %v", err)
+		os.Exit(1)
+	}
+
 	// Note: Mappings are now managed via Web UI and stored in database only
 	// No YAML sync is performed - use Web UI to create your first mapping
 
@@ -73,6 +82,17 @@ func main() {
 		cfg.Alist.SignEnabled,
 		cfg.Alist.Timeout,
 	)
+	alistClient.SetListConcurrency(cfg.Alist.ListConcurrency)
+	alistClient.SetListRateLimit(cfg.Alist.ListRateLimit)
+	if cfg.Alist.Username != "" && cfg.Alist.Password != "" {
+		alistClient.SetCredentials(alist.Credentials{
+			Username:     cfg.Alist.Username,
+			Password:     cfg.Alist.Password,
+			HashPassword: cfg.Alist.HashPassword,
+			OTPSecret:    cfg.Alist.OTPSecret,
+		})
+		logger.Info.Printf("Alist credential login enabled for user: %s", cfg.Alist.Username)
+	}
 	logger.Info.Printf("Alist client created: %s", cfg.Alist.URL)
 
 	// Test Alist connection
@@ -88,15 +108,14 @@ func main() {
 	logger.Info.Println("STRM generator created")
 
 	// Create and start scheduler
-	sched := scheduler.New(cfg, alistClient, generator, db)
+	sched := scheduler.New(cfg, alistClient, generator, db, box)
 	if err := sched.Start(); err != nil {
 		logger.Error.Printf("Failed to start scheduler: %v", err)
 		os.Exit(1)
 	}
-	defer sched.Stop()
 
 	// Create API server
-	apiServer := api.NewServer(cfg, sched, db)
+	apiServer := api.NewServer(cfg, sched, db, box)
 
 	// Register Web UI routes
 	if cfg.Web.Enabled {
@@ -134,4 +153,22 @@ func main() {
 	<-sigChan
 
 	logger.Info.Println("Shutting down gracefully...")
+
+	// Stop accepting API requests (and with them new triggers) first
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer httpCancel()
+	if err := apiServer.Shutdown(httpCtx); err != nil {
+		logger.Error.Printf("API server shutdown error: %v", err)
+	}
+
+	// Wait for running tasks; they are cancelled when the timeout expires
+	timeout := cfg.Scheduler.ShutdownTimeout * time.Second
+	logger.Info.Printf("Waiting up to %v for running tasks...", timeout)
+	schedCtx, schedCancel := context.WithTimeout(context.Background(), timeout)
+	defer schedCancel()
+	if err := sched.Shutdown(schedCtx); err != nil {
+		logger.Warn.Printf("Running tasks were interrupted: %v", err)
+	}
+
+	logger.Info.Println("Shutdown complete")
 }
@@ -0,0 +1,175 @@
+package alist
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// passwordHashSalt is the static salt Alist appends before hashing
+	// passwords for /api/auth/login/hash
+	passwordHashSalt = "-https://github.com/alist-org/alist"
+
+	// defaultTokenTTL is Alist's default token lifetime, used when the token
+	// expiry cannot be read from the JWT
+	defaultTokenTTL = 48 * time.Hour
+
+	// tokenRenewBefore renews tokens this long before they expire
+	tokenRenewBefore = 5 * time.Minute
+)
+
+// Credentials holds the account used to obtain tokens from /api/auth/login
+type Credentials struct {
+	Username     string
+	Password     string
+	HashPassword bool   // send the salted SHA-256 hash via /api/auth/login/hash
+	OTPSecret    string // base32 TOTP secret for accounts with two-factor auth
+}
+
+// LoginRequest represents a login request
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	OTPCode  string `json:"otp_code,omitempty"`
+}
+
+// LoginResponse represents the response from login API
+type LoginResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    *struct {
+		Token string `json:"token"`
+	} `json:"data"`
+}
+
+// SetCredentials enables credential-based auth: the client logs in on first
+// use, renews the token before it expires and logs in again on 401 responses
+func (c *Client) SetCredentials(creds Credentials) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	c.creds = &creds
+	c.token = ""
+	c.tokenExpiry = time.Time{}
+}
+
+// authToken returns the token to send, logging in first if needed
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.creds == nil {
+		return c.token, nil
+	}
+
+	if c.token == "" || time.Now().After(c.tokenExpiry.Add(-tokenRenewBefore)) {
+		if err := c.login(ctx); err != nil {
+			return "", err
+		}
+	}
+	return c.token, nil
+}
+
+// invalidateToken drops token after the server rejected it, unless another
+// request already replaced it. It reports whether a fresh login is possible.
+func (c *Client) invalidateToken(token string) bool {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.creds == nil {
+		return false
+	}
+	if c.token == token {
+		c.token = ""
+	}
+	return true
+}
+
+// login obtains a new token; callers must hold authMu
+func (c *Client) login(ctx context.Context) error {
+	endpoint := "/api/auth/login"
+	req := LoginRequest{
+		Username: c.creds.Username,
+		Password: c.creds.Password,
+	}
+
+	if c.creds.HashPassword {
+		endpoint = "/api/auth/login/hash"
+		sum := sha256.Sum256([]byte(c.creds.Password + passwordHashSalt))
+		req.Password = hex.EncodeToString(sum[:])
+	}
+
+	if c.creds.OTPSecret != "" {
+		code, err := totpCode(c.creds.OTPSecret, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to generate OTP code: %w", err)
+		}
+		req.OTPCode = code
+	}
+
+	var resp LoginResponse
+	if err := c.send(ctx, "POST", endpoint, "", req, &resp); err != nil {
+		return fmt.Errorf("failed to login: %w", err)
+	}
+
+	if resp.Code != 200 {
+		return fmt.Errorf("failed to login as %s: %w", c.creds.Username, &APIError{Code: resp.Code, Message: resp.Message})
+	}
+
+	if resp.Data == nil || resp.Data.Token == "" {
+		return fmt.Errorf("failed to login as %s: empty token in response", c.creds.Username)
+	}
+
+	c.token = resp.Data.Token
+	c.tokenExpiry = tokenExpiry(c.token, time.Now())
+
+	return nil
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, falling back
+// to Alist's default lifetime
+func tokenExpiry(token string, now time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			var claims struct {
+				Exp int64 `json:"exp"`
+			}
+			if json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0)
+			}
+		}
+	}
+	return now.Add(defaultTokenTTL)
+}
+
+// totpCode generates an RFC 6238 code (SHA-1, 30s step, 6 digits)
+func totpCode(secret string, now time.Time) (string, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid OTP secret: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
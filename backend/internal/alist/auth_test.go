@@ -0,0 +1,165 @@
+package alist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeJWT builds an unsigned JWT with the given expiry
+func fakeJWT(exp time.Time, n int32) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d,"n":%d}`, exp.Unix(), n)))
+	return header + "." + payload + ".sig"
+}
+
+func TestCredentials_LoginAndRenewOn401(t *testing.T) {
+	var logins int32
+	var current atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth/login":
+			var req LoginRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Username != "admin" || req.Password != "secret" {
+				json.NewEncoder(w).Encode(LoginResponse{Code: 400, Message: "password is incorrect"})
+				return
+			}
+			token := fakeJWT(time.Now().Add(48*time.Hour), atomic.AddInt32(&logins, 1))
+			current.Store(token)
+			resp := LoginResponse{Code: 200, Message: "success"}
+			resp.Data = &struct {
+				Token string `json:"token"`
+			}{Token: token}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/fs/list":
+			if r.Header.Get("Authorization") != current.Load() {
+				// Alist reports invalid tokens with HTTP 200 and code 401
+				json.NewEncoder(w).Encode(ErrorResponse{Code: 401, Message: "token is expired"})
+				return
+			}
+			json.NewEncoder(w).Encode(newListResponse([]FileItem{{Name: "movie.mp4"}}))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", false, 30)
+	client.SetCredentials(Credentials{Username: "admin", Password: "secret"})
+
+	if _, err := client.ListFiles(context.Background(), "/movies"); err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 1 {
+		t.Errorf("logins = %v, want 1", got)
+	}
+
+	// The server revokes the token; the next request must log in again
+	current.Store("revoked")
+	if _, err := client.ListFiles(context.Background(), "/movies"); err != nil {
+		t.Fatalf("ListFiles() after revocation error = %v", err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 2 {
+		t.Errorf("logins = %v, want 2 (re-login after 401)", got)
+	}
+}
+
+func TestCredentials_WrongPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(LoginResponse{Code: 400, Message: "password is incorrect"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", false, 30)
+	client.SetCredentials(Credentials{Username: "admin", Password: "wrong"})
+
+	if _, err := client.ListFiles(context.Background(), "/movies"); err == nil {
+		t.Error("ListFiles() expected login error, got nil")
+	}
+}
+
+func TestCredentials_HashedPasswordAndOTP(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret" + passwordHashSalt))
+	wantHash := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/login/hash" {
+			var req LoginRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Password != wantHash {
+				t.Errorf("hashed password = %v, want %v", req.Password, wantHash)
+			}
+			if len(req.OTPCode) != 6 {
+				t.Errorf("otp_code = %q, want 6 digits", req.OTPCode)
+			}
+			resp := LoginResponse{Code: 200}
+			resp.Data = &struct {
+				Token string `json:"token"`
+			}{Token: "hashed-token"}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		if r.Header.Get("Authorization") != "hashed-token" {
+			t.Errorf("Authorization header = %v, want hashed-token", r.Header.Get("Authorization"))
+		}
+		json.NewEncoder(w).Encode(newListResponse(nil))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", false, 30)
+	client.SetCredentials(Credentials{
+		Username:     "admin",
+		Password:     "secret",
+		HashPassword: true,
+		OTPSecret:    "JBSWY3DPEHPK3PXP",
+	})
+
+	if _, err := client.ListFiles(context.Background(), "/movies"); err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+}
+
+func TestStaticToken_UnauthorizedIsClassified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ErrorResponse{Code: 401, Message: "token is invalidated"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "stale-token", false, 30)
+	_, err := client.ListFiles(context.Background(), "/movies")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ListFiles() error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestTOTPCode_RFC6238Vector(t *testing.T) {
+	// RFC 6238 test secret "12345678901234567890" at T=59s
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := totpCode(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("totpCode() error = %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("totpCode() = %v, want 287082", code)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Unix(1893456000, 0)
+	if got := tokenExpiry(fakeJWT(exp, 1), time.Now()); !got.Equal(exp) {
+		t.Errorf("tokenExpiry() = %v, want %v", got, exp)
+	}
+
+	now := time.Now()
+	if got := tokenExpiry("not-a-jwt", now); !got.Equal(now.Add(defaultTokenTTL)) {
+		t.Errorf("tokenExpiry() fallback = %v, want now + %v", got, defaultTokenTTL)
+	}
+}
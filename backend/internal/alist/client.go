@@ -4,41 +4,99 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path"
 	"strings"
+	"sync"
 	"time"
 )
 
+// defaultListConcurrency is the number of directories listed in parallel
+// by recursive listings when no explicit value is configured
+const defaultListConcurrency = 4
+
 // Client represents an Alist API client
 type Client struct {
-	baseURL    string
-	token      string
-	signEnable bool
-	timeout    time.Duration
-	httpClient *http.Client
+	baseURL         string
+	signEnable      bool
+	timeout         time.Duration
+	listConcurrency int
+	listLimiter     rateLimiter // paces directory listings of recursive walks
+	httpClient      *http.Client
+
+	passwordFor func(path string) string // folder password lookup, may be nil
+
+	authMu      sync.Mutex // protects token, tokenExpiry and creds
+	token       string
+	tokenExpiry time.Time    // only tracked for credential-based auth
+	creds       *Credentials // nil when using a static token
 }
 
 // NewClient creates a new Alist client
 func NewClient(baseURL, token string, signEnable bool, timeout time.Duration) *Client {
 	return &Client{
-		baseURL:    strings.TrimSuffix(baseURL, "/"),
-		token:      token,
-		signEnable: signEnable,
-		timeout:    timeout,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+		token:           token,
+		signEnable:      signEnable,
+		timeout:         timeout,
+		listConcurrency: defaultListConcurrency,
 		httpClient: &http.Client{
 			Timeout: timeout * time.Second,
 		},
 	}
 }
 
+// SetListConcurrency sets how many directories recursive listings may list
+// in parallel; values <= 0 restore the default
+func (c *Client) SetListConcurrency(n int) {
+	if n <= 0 {
+		n = defaultListConcurrency
+	}
+	c.listConcurrency = n
+}
+
+// SetListRateLimit limits the directory listings of recursive walks to
+// perSecond requests per second across all listers; values <= 0 disable the
+// limit
+func (c *Client) SetListRateLimit(perSecond float64) {
+	c.listLimiter.setRate(perSecond)
+}
+
+// SetPasswordResolver sets the lookup used to fill the password of list and
+// get requests for meta-protected folders; fn returns "" for unprotected paths
+// and must be safe for concurrent use
+func (c *Client) SetPasswordResolver(fn func(path string) string) {
+	c.passwordFor = fn
+}
+
+// folderPassword returns the configured password for p, if any
+func (c *Client) folderPassword(p string) string {
+	if c.passwordFor == nil {
+		return ""
+	}
+	return c.passwordFor(p)
+}
+
 // ListFiles lists files in the specified path
 func (c *Client) ListFiles(ctx context.Context, dirPath string) ([]FileItem, error) {
+	return c.listFiles(ctx, dirPath, false)
+}
+
+// ListFilesRefresh lists files in the specified path, making Alist bypass
+// its cached listing and re-read the storage (requires write permission)
+func (c *Client) ListFilesRefresh(ctx context.Context, dirPath string) ([]FileItem, error) {
+	return c.listFiles(ctx, dirPath, true)
+}
+
+// listFiles performs a single /api/fs/list request
+func (c *Client) listFiles(ctx context.Context, dirPath string, refresh bool) ([]FileItem, error) {
 	req := ListRequest{
-		Path:    dirPath,
-		Refresh: false,
+		Path:     dirPath,
+		Password: c.folderPassword(dirPath),
+		Refresh:  refresh,
 	}
 
 	var resp ListResponse
@@ -47,7 +105,11 @@ func (c *Client) ListFiles(ctx context.Context, dirPath string) ([]FileItem, err
 	}
 
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("alist API error: %s (code: %d)", resp.Message, resp.Code)
+		apiErr := &APIError{Code: resp.Code, Message: resp.Message}
+		if errors.Is(apiErr, ErrFolderPassword) {
+			return nil, fmt.Errorf("failed to list %s: %w (%w)", dirPath, ErrFolderPassword, apiErr)
+		}
+		return nil, apiErr
 	}
 
 	if resp.Data == nil {
@@ -58,45 +120,46 @@ func (c *Client) ListFiles(ctx context.Context, dirPath string) ([]FileItem, err
 }
 
 // ListFilesRecursive lists all files recursively
+// Directories are listed in parallel, but the result keeps the depth-first
+// order of a sequential walk so callers see a deterministic file order
 func (c *Client) ListFilesRecursive(ctx context.Context, dirPath string, extensions []string) ([]FileItem, error) {
-	var result []FileItem
-
-	if err := c.listFilesRecursiveHelper(ctx, dirPath, extensions, &result); err != nil {
+	var mu sync.Mutex
+	listings := make(map[string][]FileItem)
+
+	err := c.walkDirs(ctx, dirPath, WalkOptions{}, func(dir string, entries []FileItem) error {
+		mu.Lock()
+		listings[dir] = entries
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	var result []FileItem
+	collectFiles(dirPath, listings, extensions, &result)
+
 	return result, nil
 }
 
-// listFilesRecursiveHelper is a helper function for recursive listing
-func (c *Client) listFilesRecursiveHelper(ctx context.Context, dirPath string, extensions []string, result *[]FileItem) error {
-	files, err := c.ListFiles(ctx, dirPath)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
+// collectFiles assembles the video files of a walked tree in depth-first order
+func collectFiles(dirPath string, listings map[string][]FileItem, extensions []string, result *[]FileItem) {
+	for _, file := range listings[dirPath] {
 		if file.IsDir {
-			// Recursively list subdirectory
-			subPath := path.Join(dirPath, file.Name)
-			if err := c.listFilesRecursiveHelper(ctx, subPath, extensions, result); err != nil {
-				return err
-			}
+			collectFiles(path.Join(dirPath, file.Name), listings, extensions, result)
 		} else if file.IsVideo(extensions) {
 			// Set full path for the file
 			file.Path = path.Join(dirPath, file.Name)
-			// Add video file to result
 			*result = append(*result, file)
 		}
 	}
-
-	return nil
 }
 
 // GetFileURL gets the direct URL of a file
 func (c *Client) GetFileURL(ctx context.Context, filePath string) (string, error) {
 	req := GetRequest{
-		Path: filePath,
+		Path:     filePath,
+		Password: c.folderPassword(filePath),
 	}
 
 	var resp GetResponse
@@ -105,7 +168,11 @@ func (c *Client) GetFileURL(ctx context.Context, filePath string) (string, error
 	}
 
 	if resp.Code != 200 {
-		return "", fmt.Errorf("alist API error: %s (code: %d)", resp.Message, resp.Code)
+		apiErr := &APIError{Code: resp.Code, Message: resp.Message}
+		if errors.Is(apiErr, ErrFolderPassword) {
+			return "", fmt.Errorf("failed to get %s: %w (%w)", filePath, ErrFolderPassword, apiErr)
+		}
+		return "", apiErr
 	}
 
 	if resp.Data == nil {
@@ -126,8 +193,26 @@ func (c *Client) GetFileURL(ctx context.Context, filePath string) (string, error
 	return fileURL, nil
 }
 
-// doRequest performs an HTTP request
+// doRequest performs an authenticated HTTP request
+// With credentials configured, a request rejected as unauthorized is retried
+// once with a freshly obtained token.
 func (c *Client) doRequest(ctx context.Context, method, endpoint string, reqBody, respBody interface{}) error {
+	for attempt := 0; ; attempt++ {
+		token, err := c.authToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = c.send(ctx, method, endpoint, token, reqBody, respBody)
+		if attempt == 0 && errors.Is(err, ErrUnauthorized) && c.invalidateToken(token) {
+			continue
+		}
+		return err
+	}
+}
+
+// send performs a single HTTP request with the given token
+func (c *Client) send(ctx context.Context, method, endpoint, token string, reqBody, respBody interface{}) error {
 	var body io.Reader
 	if reqBody != nil {
 		data, err := json.Marshal(reqBody)
@@ -145,8 +230,8 @@ func (c *Client) doRequest(ctx context.Context, method, endpoint string, reqBody
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	if c.token != "" {
-		req.Header.Set("Authorization", c.token)
+	if token != "" {
+		req.Header.Set("Authorization", token)
 	}
 
 	// Perform request
@@ -168,11 +253,23 @@ func (c *Client) doRequest(ctx context.Context, method, endpoint string, reqBody
 	if resp.StatusCode != http.StatusOK {
 		var errResp ErrorResponse
 		if err := json.Unmarshal(respData, &errResp); err == nil {
+			if resp.StatusCode == http.StatusUnauthorized {
+				return fmt.Errorf("HTTP %d: %w", resp.StatusCode, &APIError{Code: 401, Message: errResp.Message})
+			}
 			return fmt.Errorf("HTTP %d: %s (code: %d)", resp.StatusCode, errResp.Message, errResp.Code)
 		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("HTTP %d: %s: %w", resp.StatusCode, string(respData), ErrUnauthorized)
+		}
 		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respData))
 	}
 
+	// Alist reports expired or invalid tokens as code 401 with HTTP 200
+	var envelope ErrorResponse
+	if json.Unmarshal(respData, &envelope) == nil && envelope.Code == http.StatusUnauthorized {
+		return &APIError{Code: envelope.Code, Message: envelope.Message}
+	}
+
 	// Unmarshal response
 	if respBody != nil {
 		if err := json.Unmarshal(respData, respBody); err != nil {
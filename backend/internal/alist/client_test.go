@@ -3,8 +3,14 @@ package alist
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -158,9 +164,9 @@ func TestListFiles_APIError(t *testing.T) {
 }
 
 func TestListFilesRecursive_Success(t *testing.T) {
-	callCount := 0
+	var callCount int32
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		callCount++
+		atomic.AddInt32(&callCount, 1)
 		var req ListRequest
 		json.NewDecoder(r.Body).Decode(&req)
 
@@ -220,8 +226,8 @@ func TestListFilesRecursive_Success(t *testing.T) {
 		t.Errorf("len(files) = %v, want 2", len(files))
 	}
 
-	if callCount != 2 {
-		t.Errorf("API call count = %v, want 2 (root + subdirectory)", callCount)
+	if got := atomic.LoadInt32(&callCount); got != 2 {
+		t.Errorf("API call count = %v, want 2 (root + subdirectory)", got)
 	}
 }
 
@@ -262,6 +268,171 @@ func TestListFilesRecursive_FilterByExtension(t *testing.T) {
 	}
 }
 
+// newListResponse builds a successful list response with the given entries
+func newListResponse(items []FileItem) ListResponse {
+	return ListResponse{
+		Code:    200,
+		Message: "success",
+		Data: &struct {
+			Content  []FileItem `json:"content"`
+			Total    int        `json:"total"`
+			Readme   string     `json:"readme,omitempty"`
+			Write    bool       `json:"write,omitempty"`
+			Provider string     `json:"provider,omitempty"`
+		}{
+			Content: items,
+			Total:   len(items),
+		},
+	}
+}
+
+func TestListFilesRecursive_ParallelKeepsOrder(t *testing.T) {
+	tree := map[string][]FileItem{
+		"/lib": {
+			{Name: "a", IsDir: true},
+			{Name: "root.mp4"},
+			{Name: "b", IsDir: true},
+		},
+		"/lib/a": {
+			{Name: "a1.mkv"},
+			{Name: "deep", IsDir: true},
+			{Name: "a2.mkv"},
+		},
+		"/lib/a/deep": {{Name: "d1.mp4"}},
+		"/lib/b":      {{Name: "b1.mp4"}, {Name: "b2.txt"}},
+	}
+
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(newListResponse(tree[req.Path]))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	client.SetListConcurrency(2)
+
+	files, err := client.ListFilesRecursive(context.Background(), "/lib", []string{"mp4", "mkv"})
+	if err != nil {
+		t.Fatalf("ListFilesRecursive() error = %v", err)
+	}
+
+	want := []string{"/lib/a/a1.mkv", "/lib/a/deep/d1.mp4", "/lib/a/a2.mkv", "/lib/root.mp4", "/lib/b/b1.mp4"}
+	if len(files) != len(want) {
+		t.Fatalf("len(files) = %v, want %v", len(files), len(want))
+	}
+	for i, f := range files {
+		if f.Path != want[i] {
+			t.Errorf("files[%d].Path = %v, want %v", i, f.Path, want[i])
+		}
+	}
+
+	if got := atomic.LoadInt32(&maxInFlight); got > 2 {
+		t.Errorf("max concurrent listings = %v, want <= 2", got)
+	}
+}
+
+func TestListFilesRecursive_StopsOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Path == "/lib/broken" {
+			json.NewEncoder(w).Encode(ListResponse{Code: 500, Message: "storage error"})
+			return
+		}
+
+		var items []FileItem
+		if req.Path == "/lib" {
+			items = append(items, FileItem{Name: "broken", IsDir: true})
+			for i := 0; i < 5; i++ {
+				items = append(items, FileItem{Name: fmt.Sprintf("dir%d", i), IsDir: true})
+			}
+		} else {
+			items = append(items, FileItem{Name: path.Base(req.Path) + ".mp4"})
+		}
+		json.NewEncoder(w).Encode(newListResponse(items))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	if _, err := client.ListFilesRecursive(context.Background(), "/lib", []string{"mp4"}); err == nil {
+		t.Error("ListFilesRecursive() expected error when a subdirectory fails, got nil")
+	}
+}
+
+func TestListFilesRecursive_ContextCancelled(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		json.NewEncoder(w).Encode(newListResponse([]FileItem{{Name: "sub", IsDir: true}}))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.ListFilesRecursive(ctx, "/lib", []string{"mp4"}); err == nil {
+		t.Error("ListFilesRecursive() expected error for cancelled context, got nil")
+	}
+	if got := atomic.LoadInt32(&callCount); got != 0 {
+		t.Errorf("API call count = %v, want 0 after cancellation", got)
+	}
+}
+
+func TestWalkFiles_BatchesPerDirectory(t *testing.T) {
+	tree := map[string][]FileItem{
+		"/lib":            {{Name: "show", IsDir: true}, {Name: "movie.mp4"}, {Name: "notes.txt"}},
+		"/lib/show":       {{Name: "empty", IsDir: true}, {Name: "e01.mkv"}, {Name: "e01.mp4"}},
+		"/lib/show/empty": {},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(newListResponse(tree[req.Path]))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+
+	var mu sync.Mutex
+	batches := make(map[string][]string)
+	err := client.WalkFiles(context.Background(), "/lib", WalkOptions{Extensions: []string{"mp4", "mkv"}}, func(dir string, files []FileItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, f := range files {
+			batches[dir] = append(batches[dir], f.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	if len(batches) != 2 {
+		t.Errorf("len(batches) = %v, want 2 (directories without videos are not reported)", len(batches))
+	}
+	if got := batches["/lib"]; len(got) != 1 || got[0] != "/lib/movie.mp4" {
+		t.Errorf("batches[/lib] = %v, want [/lib/movie.mp4]", got)
+	}
+	if got := batches["/lib/show"]; len(got) != 2 {
+		t.Errorf("batches[/lib/show] = %v, want 2 files", got)
+	}
+}
+
 func TestGetFileURL_WithRawURL(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := GetResponse{
@@ -503,3 +674,33 @@ func TestHTTP_ErrorResponse(t *testing.T) {
 		t.Error("ListFiles() expected error for HTTP error, got nil")
 	}
 }
+
+func TestFolderPassword_SentAndClassified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Password != "open-sesame" {
+			json.NewEncoder(w).Encode(ErrorResponse{Code: 403, Message: "password is incorrect or you have no permission"})
+			return
+		}
+		json.NewEncoder(w).Encode(newListResponse([]FileItem{{Name: "movie.mp4"}}))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+
+	_, err := client.ListFiles(context.Background(), "/private/movies")
+	if !errors.Is(err, ErrFolderPassword) {
+		t.Errorf("ListFiles() without password error = %v, want ErrFolderPassword", err)
+	}
+
+	client.SetPasswordResolver(func(p string) string {
+		if strings.HasPrefix(p, "/private") {
+			return "open-sesame"
+		}
+		return ""
+	})
+	if _, err := client.ListFiles(context.Background(), "/private/movies"); err != nil {
+		t.Errorf("ListFiles() with password error = %v", err)
+	}
+}
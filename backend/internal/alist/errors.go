@@ -0,0 +1,44 @@
+package alist
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is matched by errors caused by a missing, invalid or expired token
+	ErrUnauthorized = errors.New("alist: unauthorized")
+
+	// ErrFolderPassword is matched by errors caused by a missing or wrong
+	// password for a meta-protected folder
+	ErrFolderPassword = errors.New("alist: folder password is missing or incorrect")
+
+	// ErrNotFound is matched by errors caused by a path that does not exist
+	ErrNotFound = errors.New("alist: object not found")
+)
+
+// APIError represents a non-200 code in an Alist response envelope
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("alist API error: %s (code: %d)", e.Message, e.Code)
+}
+
+// Is lets errors.Is classify API errors by code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Code == 401
+	case ErrFolderPassword:
+		// Alist: "password is incorrect or you have no permission"
+		return e.Code == 403 && strings.Contains(strings.ToLower(e.Message), "password")
+	case ErrNotFound:
+		// Alist: "object not found" (code 500)
+		return strings.Contains(strings.ToLower(e.Message), "not found")
+	}
+	return false
+}
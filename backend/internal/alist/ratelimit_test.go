@@ -0,0 +1,42 @@
+package alist
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var l rateLimiter
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait without limit: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("unlimited waits took %v", elapsed)
+	}
+
+	l.setRate(100)
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	// The first request starts right away, the others 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests at 100/s took %v, want at least 40ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	l.setRate(0.1)
+	l.wait(ctx)
+	if err := l.wait(cancelled); err == nil {
+		t.Error("wait should return the context error")
+	}
+}
@@ -0,0 +1,194 @@
+package alist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// searchPageSize is the number of results requested per search page
+const searchPageSize = 500
+
+// searchScopeFiles restricts /api/fs/search to files
+const searchScopeFiles = 2
+
+// maxSearchFiles bounds the files SearchFiles holds in memory. Search
+// results arrive per extension rather than per directory, so they are
+// collected before fn is called; larger sources fall back to a walk.
+var maxSearchFiles = 100000
+
+// ErrSearchUnavailable is returned when the search index cannot be used for
+// discovery (search disabled, index missing, building or stale)
+var ErrSearchUnavailable = errors.New("alist: search index unavailable")
+
+// SearchRequest represents a request to search files
+type SearchRequest struct {
+	Parent   string `json:"parent"`
+	Keywords string `json:"keywords"`
+	Scope    int    `json:"scope"` // 0 all, 1 folders, 2 files
+	Page     int    `json:"page"`
+	PerPage  int    `json:"per_page"`
+	Password string `json:"password,omitempty"`
+}
+
+// SearchResponse represents the response from search API
+type SearchResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    *struct {
+		Content []SearchItem `json:"content"`
+		Total   int          `json:"total"`
+	} `json:"data"`
+}
+
+// SearchItem represents a search result
+type SearchItem struct {
+	Parent string `json:"parent"`
+	Name   string `json:"name"`
+	IsDir  bool   `json:"is_dir"`
+	Size   int64  `json:"size"`
+	Type   int    `json:"type"`
+}
+
+// IndexProgressResponse represents the response from the index progress API
+type IndexProgressResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    *struct {
+		ObjCount     int       `json:"obj_count"`
+		IsDone       bool      `json:"is_done"`
+		LastDoneTime time.Time `json:"last_done_time"`
+		Error        string    `json:"error"`
+	} `json:"data"`
+}
+
+// SearchFiles enumerates the video files below dirPath with Alist's search
+// index and calls fn once per directory, like WalkFiles.
+// Unlike a walk, all results are held in memory until the search is done,
+// so that every directory is reported once with all of its files.
+// It returns an error matching ErrSearchUnavailable, before fn is called,
+// when the index is disabled, still building, older than opts.MaxIndexAge,
+// returns no files at all, or more than maxSearchFiles files.
+func (c *Client) SearchFiles(ctx context.Context, dirPath string, opts WalkOptions, fn func(dir string, files []FileItem) error) error {
+	if err := c.checkIndex(ctx, opts.MaxIndexAge); err != nil {
+		return err
+	}
+
+	// Search every extension as a keyword and keep real suffix matches only;
+	// a file can match several keywords, so results are keyed by path
+	byDir := make(map[string][]FileItem)
+	seen := make(map[string]bool)
+
+	for _, ext := range opts.Extensions {
+		for page := 1; ; page++ {
+			items, total, err := c.searchPage(ctx, dirPath, ext, page)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range items {
+				file := FileItem{
+					Name:  item.Name,
+					Size:  item.Size,
+					IsDir: item.IsDir,
+					Type:  item.Type,
+					Path:  path.Join(item.Parent, item.Name),
+				}
+				if !file.IsVideo(opts.Extensions) || seen[file.Path] || !IsWithin(file.Path, dirPath) {
+					continue
+				}
+				if len(seen) >= maxSearchFiles {
+					return fmt.Errorf("%w: more than %d files in index for %s", ErrSearchUnavailable, maxSearchFiles, dirPath)
+				}
+				seen[file.Path] = true
+				byDir[item.Parent] = append(byDir[item.Parent], file)
+			}
+
+			if len(items) == 0 || page*searchPageSize >= total {
+				break
+			}
+		}
+	}
+
+	if len(seen) == 0 {
+		return fmt.Errorf("%w: no files found in index for %s", ErrSearchUnavailable, dirPath)
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(dir, byDir[dir]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// searchPage fetches one page of file search results
+func (c *Client) searchPage(ctx context.Context, dirPath, keyword string, page int) ([]SearchItem, int, error) {
+	req := SearchRequest{
+		Parent:   dirPath,
+		Keywords: keyword,
+		Scope:    searchScopeFiles,
+		Page:     page,
+		PerPage:  searchPageSize,
+		Password: c.folderPassword(dirPath),
+	}
+
+	var resp SearchResponse
+	if err := c.doRequest(ctx, "POST", "/api/fs/search", req, &resp); err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("%w: %w", ErrSearchUnavailable, err)
+	}
+
+	if resp.Code != 200 {
+		return nil, 0, fmt.Errorf("%w: %w", ErrSearchUnavailable, &APIError{Code: resp.Code, Message: resp.Message})
+	}
+
+	if resp.Data == nil {
+		return nil, 0, nil
+	}
+	return resp.Data.Content, resp.Data.Total, nil
+}
+
+// checkIndex rejects an index that is still building, failed or is older than
+// maxAge. The progress API needs an admin token; if it cannot be read the
+// index is assumed usable.
+func (c *Client) checkIndex(ctx context.Context, maxAge time.Duration) error {
+	var resp IndexProgressResponse
+	if err := c.doRequest(ctx, "GET", "/api/admin/index/progress", nil, &resp); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return nil
+	}
+	if resp.Code != 200 || resp.Data == nil {
+		return nil
+	}
+
+	progress := resp.Data
+	if progress.Error != "" {
+		return fmt.Errorf("%w: index error: %s", ErrSearchUnavailable, progress.Error)
+	}
+	if !progress.IsDone {
+		return fmt.Errorf("%w: index is being built", ErrSearchUnavailable)
+	}
+	if maxAge > 0 && time.Since(progress.LastDoneTime) > maxAge {
+		return fmt.Errorf("%w: index last built at %s", ErrSearchUnavailable, progress.LastDoneTime.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package alist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSearchResponse builds a successful search response
+func newSearchResponse(items []SearchItem) SearchResponse {
+	resp := SearchResponse{Code: 200, Message: "success"}
+	resp.Data = &struct {
+		Content []SearchItem `json:"content"`
+		Total   int          `json:"total"`
+	}{Content: items, Total: len(items)}
+	return resp
+}
+
+func TestWalkFiles_UsesSearchIndex(t *testing.T) {
+	var listCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/admin/index/progress":
+			resp := IndexProgressResponse{Code: 200}
+			resp.Data = &struct {
+				ObjCount     int       `json:"obj_count"`
+				IsDone       bool      `json:"is_done"`
+				LastDoneTime time.Time `json:"last_done_time"`
+				Error        string    `json:"error"`
+			}{ObjCount: 10, IsDone: true, LastDoneTime: time.Now()}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/fs/search":
+			var req SearchRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Parent != "/media" || req.Scope != searchScopeFiles {
+				t.Errorf("search parent/scope = %v/%v, want /media/2", req.Parent, req.Scope)
+			}
+			var items []SearchItem
+			switch req.Keywords {
+			case "mp4":
+				items = []SearchItem{
+					{Parent: "/media/show", Name: "e01.mp4"},
+					{Parent: "/media", Name: "movie.mp4"},
+					{Parent: "/media", Name: "mp4-notes.txt"},
+				}
+			case "mkv":
+				items = []SearchItem{
+					{Parent: "/media/show", Name: "e01.mkv"},
+					{Parent: "/media-other", Name: "outside.mkv"},
+				}
+			}
+			json.NewEncoder(w).Encode(newSearchResponse(items))
+		case "/api/fs/list":
+			atomic.AddInt32(&listCalls, 1)
+			json.NewEncoder(w).Encode(newListResponse(nil))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+
+	var mu sync.Mutex
+	batches := make(map[string]int)
+	opts := WalkOptions{Extensions: []string{"mp4", "mkv"}, UseSearch: true, MaxIndexAge: time.Hour}
+	err := client.WalkFiles(context.Background(), "/media", opts, func(dir string, files []FileItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches[dir] += len(files)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	if batches["/media"] != 1 || batches["/media/show"] != 2 || len(batches) != 2 {
+		t.Errorf("batches = %v, want /media:1 and /media/show:2", batches)
+	}
+	if got := atomic.LoadInt32(&listCalls); got != 0 {
+		t.Errorf("list calls = %v, want 0 when the index is usable", got)
+	}
+}
+
+func TestWalkFiles_FallsBackWhenSearchUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/admin/index/progress":
+			json.NewEncoder(w).Encode(ErrorResponse{Code: 403, Message: "You are not an admin"})
+		case "/api/fs/search":
+			json.NewEncoder(w).Encode(ErrorResponse{Code: 500, Message: "search not available"})
+		case "/api/fs/list":
+			json.NewEncoder(w).Encode(newListResponse([]FileItem{{Name: "movie.mp4"}}))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+
+	var fallback error
+	var found int32
+	opts := WalkOptions{
+		Extensions:       []string{"mp4"},
+		UseSearch:        true,
+		OnSearchFallback: func(reason error) { fallback = reason },
+	}
+	err := client.WalkFiles(context.Background(), "/media", opts, func(dir string, files []FileItem) error {
+		atomic.AddInt32(&found, int32(len(files)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	if !errors.Is(fallback, ErrSearchUnavailable) {
+		t.Errorf("fallback reason = %v, want ErrSearchUnavailable", fallback)
+	}
+	if found != 1 {
+		t.Errorf("found = %v, want 1 file from the directory walk", found)
+	}
+}
+
+func TestSearchFiles_StaleIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := IndexProgressResponse{Code: 200}
+		resp.Data = &struct {
+			ObjCount     int       `json:"obj_count"`
+			IsDone       bool      `json:"is_done"`
+			LastDoneTime time.Time `json:"last_done_time"`
+			Error        string    `json:"error"`
+		}{IsDone: true, LastDoneTime: time.Now().Add(-48 * time.Hour)}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	opts := WalkOptions{Extensions: []string{"mp4"}, MaxIndexAge: 24 * time.Hour}
+	err := client.SearchFiles(context.Background(), "/media", opts, func(string, []FileItem) error { return nil })
+	if !errors.Is(err, ErrSearchUnavailable) {
+		t.Errorf("SearchFiles() error = %v, want ErrSearchUnavailable for a stale index", err)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		p, dir string
+		want   bool
+	}{
+		{"/media/movies", "/media/movies", true},
+		{"/media/movies/a.mkv", "/media/movies/", true},
+		{"/media/movies-hd/a.mkv", "/media/movies", false},
+		{"/media", "/media/movies", false},
+		{"/media/movies", "/", true},
+	}
+	for _, tt := range tests {
+		if got := IsWithin(tt.p, tt.dir); got != tt.want {
+			t.Errorf("IsWithin(%q, %q) = %v, want %v", tt.p, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFiles_TooManyFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/admin/index/progress":
+			json.NewEncoder(w).Encode(ErrorResponse{Code: 403, Message: "You are not an admin"})
+		case "/api/fs/search":
+			json.NewEncoder(w).Encode(newSearchResponse([]SearchItem{
+				{Parent: "/media/a", Name: "one.mp4"},
+				{Parent: "/media/b", Name: "two.mp4"},
+			}))
+		}
+	}))
+	defer server.Close()
+
+	defer func(n int) { maxSearchFiles = n }(maxSearchFiles)
+	maxSearchFiles = 1
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	called := false
+	err := client.SearchFiles(context.Background(), "/media", WalkOptions{Extensions: []string{"mp4"}}, func(dir string, files []FileItem) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrSearchUnavailable) || !strings.Contains(err.Error(), "more than 1 files") {
+		t.Errorf("SearchFiles() error = %v, want ErrSearchUnavailable for too many files", err)
+	}
+	if called {
+		t.Error("fn should not be called when the search is too large")
+	}
+}
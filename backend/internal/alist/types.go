@@ -1,6 +1,9 @@
 package alist
 
-import "time"
+import (
+	"path"
+	"time"
+)
 
 // ListRequest represents a request to list files
 type ListRequest struct {
@@ -79,3 +82,13 @@ func (f *FileItem) IsVideo(extensions []string) bool {
 	}
 	return false
 }
+
+// IsWithin reports whether the Alist path p is dir or below it
+func IsWithin(p, dir string) bool {
+	dir = path.Clean(dir)
+	p = path.Clean(p)
+	if dir == "/" || p == dir {
+		return true
+	}
+	return len(p) > len(dir) && p[:len(dir)] == dir && p[len(dir)] == '/'
+}
@@ -0,0 +1,233 @@
+package alist
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+)
+
+// DirCache stores directory listings between walks so that directories whose
+// modified time has not changed can be served without calling Alist.
+//
+// A cached listing is only used with a modified time taken from a fresh
+// listing of the parent directory: the subdirectories of a cached listing
+// carry the modified times of when it was stored, so they are listed from
+// Alist again. Most storages do not update the modified time of ancestors
+// when something deep in the tree changes, so every level is revalidated
+// this way. The cache still misses changes that leave the modified time of
+// their directory unchanged, e.g. a file replaced in place under the same
+// name, or storages that never update directory modified times; those are
+// picked up by the next deep scan.
+type DirCache interface {
+	// GetDir returns the cached listing of dir if it was stored with the
+	// given modified time
+	GetDir(dir string, modified time.Time) ([]FileItem, bool)
+	// PutDir stores a fresh listing of dir
+	PutDir(dir string, modified time.Time, entries []FileItem)
+}
+
+// WalkOptions controls a recursive walk
+type WalkOptions struct {
+	Extensions []string // video extensions reported by WalkFiles
+
+	// Cache, if set, is consulted before listing a subdirectory whose
+	// modified time comes from a fresh listing of its parent, and receives
+	// every fresh listing. The walk root is always listed from Alist because
+	// its modified time is unknown.
+	Cache DirCache
+
+	// Refresh, if set, selects directories whose listing must bypass both
+	// Alist's cache and Cache
+	Refresh func(dir string) bool
+
+	// UseSearch discovers files through Alist's search index instead of
+	// listing every directory, falling back to a walk when the index cannot
+	// be used. OnSearchFallback, if set, is told why the fallback happened.
+	UseSearch        bool
+	MaxIndexAge      time.Duration // reject indexes built longer ago; 0 disables the check
+	OnSearchFallback func(reason error)
+
+	// Skip, if set, selects directories that are neither listed nor
+	// descended into, e.g. subtrees completed by an earlier run. It only
+	// applies to listing; search results are not filtered.
+	Skip func(dir string) bool
+
+	// OnDir, if set, is called once per directory after fn has received all
+	// of its files (or right away when it has none). subdirs lists the
+	// directories found below dir, or is nil when unknown (search index).
+	// OnDir may be called concurrently.
+	OnDir func(dir string, subdirs []string)
+}
+
+// walkEntry is a directory waiting to be listed
+type walkEntry struct {
+	path     string
+	modified time.Time // as reported by a fresh parent listing; zero for the root and below cached listings
+}
+
+// WalkFiles walks dirPath recursively and calls fn with the video files of
+// each directory as soon as that directory has been listed, so callers can
+// start processing before the whole tree is known.
+// fn may be called concurrently and must be safe for concurrent use; returning
+// an error from fn stops the walk. With opts.UseSearch the files come from
+// SearchFiles when the search index is usable.
+func (c *Client) WalkFiles(ctx context.Context, dirPath string, opts WalkOptions, fn func(dir string, files []FileItem) error) error {
+	if opts.UseSearch {
+		searchFn := fn
+		if opts.OnDir != nil {
+			searchFn = func(dir string, files []FileItem) error {
+				if err := fn(dir, files); err != nil {
+					return err
+				}
+				opts.OnDir(dir, nil)
+				return nil
+			}
+		}
+		err := c.SearchFiles(ctx, dirPath, opts, searchFn)
+		if !errors.Is(err, ErrSearchUnavailable) {
+			return err
+		}
+		if opts.OnSearchFallback != nil {
+			opts.OnSearchFallback(err)
+		}
+	}
+
+	return c.walkDirs(ctx, dirPath, opts, func(dir string, entries []FileItem) error {
+		var files []FileItem
+		subdirs := []string{}
+		for _, file := range entries {
+			if file.IsDir {
+				subdirs = append(subdirs, path.Join(dir, file.Name))
+			} else if file.IsVideo(opts.Extensions) {
+				file.Path = path.Join(dir, file.Name)
+				files = append(files, file)
+			}
+		}
+		if len(files) > 0 {
+			if err := fn(dir, files); err != nil {
+				return err
+			}
+		}
+		if opts.OnDir != nil {
+			opts.OnDir(dir, subdirs)
+		}
+		return nil
+	})
+}
+
+// walkDirs lists root and all of its subdirectories using a bounded pool of
+// listers paced by the client's list rate limit, calling visit with the raw listing of every directory.
+// visit may be called concurrently and must be safe for concurrent use.
+// The walk stops at the first listing or visit error, or when ctx is done.
+func (c *Client) walkDirs(ctx context.Context, root string, opts WalkOptions, visit func(dir string, entries []FileItem) error) error {
+	workers := c.listConcurrency
+	if workers <= 0 {
+		workers = defaultListConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		stack   = []walkEntry{{path: root}} // directories waiting to be listed
+		pending = 1                         // directories queued or being listed
+		walkErr error
+	)
+
+	worker := func() {
+		for {
+			mu.Lock()
+			for len(stack) == 0 && pending > 0 && walkErr == nil {
+				cond.Wait()
+			}
+			if pending == 0 || walkErr != nil {
+				mu.Unlock()
+				return
+			}
+			dir := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			mu.Unlock()
+
+			if opts.Skip != nil && opts.Skip(dir.path) {
+				mu.Lock()
+				pending--
+				cond.Broadcast()
+				mu.Unlock()
+				continue
+			}
+
+			entries, cached, err := c.listDir(ctx, dir, opts)
+			if err == nil {
+				err = visit(dir.path, entries)
+			}
+
+			mu.Lock()
+			if err != nil {
+				if walkErr == nil {
+					walkErr = err
+				}
+			} else {
+				// Push subdirectories in reverse so they are popped in listing
+				// order; below a cached listing their modified times are stale
+				for i := len(entries) - 1; i >= 0; i-- {
+					if entries[i].IsDir {
+						sub := walkEntry{path: path.Join(dir.path, entries[i].Name)}
+						if !cached {
+							sub.modified = entries[i].Modified
+						}
+						stack = append(stack, sub)
+						pending++
+					}
+				}
+			}
+			pending--
+			cond.Broadcast()
+			mu.Unlock()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+
+	return walkErr
+}
+
+// listDir lists a single directory unless ctx is already done, preferring a
+// cached listing when the directory is unchanged and no refresh is requested;
+// cached reports whether the listing came from the cache.
+// Only requests sent to Alist wait for the rate limit.
+func (c *Client) listDir(ctx context.Context, dir walkEntry, opts WalkOptions) (entries []FileItem, cached bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	refresh := opts.Refresh != nil && opts.Refresh(dir.path)
+
+	if opts.Cache != nil && !dir.modified.IsZero() && !refresh {
+		if entries, ok := opts.Cache.GetDir(dir.path, dir.modified); ok {
+			return entries, true, nil
+		}
+	}
+
+	if err := c.listLimiter.wait(ctx); err != nil {
+		return nil, false, err
+	}
+	entries, err = c.listFiles(ctx, dir.path, refresh)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if opts.Cache != nil && !dir.modified.IsZero() {
+		opts.Cache.PutDir(dir.path, dir.modified, entries)
+	}
+
+	return entries, false, nil
+}
@@ -0,0 +1,249 @@
+package alist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryDirCache is an in-memory DirCache for tests
+type memoryDirCache struct {
+	mu       sync.Mutex
+	listings map[string][]FileItem
+	modified map[string]time.Time
+}
+
+func newMemoryDirCache() *memoryDirCache {
+	return &memoryDirCache{
+		listings: make(map[string][]FileItem),
+		modified: make(map[string]time.Time),
+	}
+}
+
+func (m *memoryDirCache) GetDir(dir string, modified time.Time) ([]FileItem, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached, ok := m.modified[dir]; !ok || !cached.Equal(modified) {
+		return nil, false
+	}
+	return m.listings[dir], true
+}
+
+func (m *memoryDirCache) PutDir(dir string, modified time.Time, entries []FileItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listings[dir] = entries
+	m.modified[dir] = modified
+}
+
+func TestWalkFiles_SkipsUnchangedDirectories(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	tree := map[string][]FileItem{
+		"/lib":        {{Name: "static", IsDir: true, Modified: t1}, {Name: "active", IsDir: true, Modified: t1}},
+		"/lib/static": {{Name: "old.mp4"}},
+		"/lib/active": {{Name: "new.mp4"}},
+	}
+
+	var mu sync.Mutex
+	listed := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		listed[req.Path]++
+		items := tree[req.Path]
+		mu.Unlock()
+		json.NewEncoder(w).Encode(newListResponse(items))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	cache := newMemoryDirCache()
+	walk := func() int {
+		count := 0
+		var countMu sync.Mutex
+		opts := WalkOptions{Extensions: []string{"mp4"}, Cache: cache}
+		err := client.WalkFiles(context.Background(), "/lib", opts, func(dir string, files []FileItem) error {
+			countMu.Lock()
+			count += len(files)
+			countMu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkFiles() error = %v", err)
+		}
+		return count
+	}
+
+	if got := walk(); got != 2 {
+		t.Errorf("first walk found %v files, want 2", got)
+	}
+
+	// Only "active" changes; "static" must be served from the cache
+	mu.Lock()
+	tree["/lib"][1].Modified = t2
+	tree["/lib/active"] = append(tree["/lib/active"], FileItem{Name: "newer.mp4"})
+	mu.Unlock()
+
+	if got := walk(); got != 3 {
+		t.Errorf("second walk found %v files, want 3 (cached files are still reported)", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if listed["/lib"] != 2 {
+		t.Errorf("root listed %v times, want 2 (root is never cached)", listed["/lib"])
+	}
+	if listed["/lib/static"] != 1 {
+		t.Errorf("unchanged directory listed %v times, want 1", listed["/lib/static"])
+	}
+	if listed["/lib/active"] != 2 {
+		t.Errorf("changed directory listed %v times, want 2", listed["/lib/active"])
+	}
+}
+
+func TestWalkFiles_RevalidatesBelowCachedListings(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tree := map[string][]FileItem{
+		"/lib":               {{Name: "show", IsDir: true, Modified: t1}},
+		"/lib/show":          {{Name: "season 1", IsDir: true, Modified: t1}},
+		"/lib/show/season 1": {{Name: "e01.mp4"}},
+	}
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		items := tree[req.Path]
+		mu.Unlock()
+		json.NewEncoder(w).Encode(newListResponse(items))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	cache := newMemoryDirCache()
+	walk := func() int {
+		count := 0
+		var countMu sync.Mutex
+		err := client.WalkFiles(context.Background(), "/lib", WalkOptions{Extensions: []string{"mp4"}, Cache: cache}, func(dir string, files []FileItem) error {
+			countMu.Lock()
+			count += len(files)
+			countMu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkFiles() error = %v", err)
+		}
+		return count
+	}
+	walk()
+
+	// A new episode only changes its own directory; "show" keeps its
+	// modified time and is served from the cache with the old value
+	mu.Lock()
+	tree["/lib/show"] = []FileItem{{Name: "season 1", IsDir: true, Modified: t1.Add(time.Hour)}}
+	tree["/lib/show/season 1"] = append(tree["/lib/show/season 1"], FileItem{Name: "e02.mp4"})
+	mu.Unlock()
+
+	if got := walk(); got != 2 {
+		t.Errorf("second walk found %v files, want 2 (nested change must not be missed)", got)
+	}
+}
+
+func TestWalkFiles_RefreshSelectedDirectories(t *testing.T) {
+	var mu sync.Mutex
+	refreshed := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		refreshed[req.Path] = req.Refresh
+		mu.Unlock()
+
+		var items []FileItem
+		if req.Path == "/lib" {
+			items = []FileItem{{Name: "a", IsDir: true}, {Name: "b", IsDir: true}}
+		}
+		json.NewEncoder(w).Encode(newListResponse(items))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	opts := WalkOptions{
+		Extensions: []string{"mp4"},
+		Refresh:    func(dir string) bool { return dir != "/lib/b" },
+	}
+	if err := client.WalkFiles(context.Background(), "/lib", opts, func(string, []FileItem) error { return nil }); err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !refreshed["/lib"] || !refreshed["/lib/a"] || refreshed["/lib/b"] {
+		t.Errorf("refresh flags = %v, want /lib and /lib/a refreshed only", refreshed)
+	}
+}
+
+func TestWalkFiles_SkipAndOnDir(t *testing.T) {
+	tree := map[string][]FileItem{
+		"/lib":        {{Name: "done", IsDir: true}, {Name: "todo", IsDir: true}, {Name: "a.mp4"}},
+		"/lib/done":   {{Name: "old.mp4"}, {Name: "deep", IsDir: true}},
+		"/lib/todo":   {{Name: "new.mp4"}},
+		"/lib/done/x": {{Name: "never.mp4"}},
+	}
+
+	var mu sync.Mutex
+	listed := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		listed[req.Path] = true
+		mu.Unlock()
+		json.NewEncoder(w).Encode(newListResponse(tree[req.Path]))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", false, 30)
+	seen := make(map[string][]string)
+	opts := WalkOptions{
+		Extensions: []string{"mp4"},
+		Skip:       func(dir string) bool { return dir == "/lib/done" },
+		OnDir: func(dir string, subdirs []string) {
+			mu.Lock()
+			seen[dir] = subdirs
+			mu.Unlock()
+		},
+	}
+	err := client.WalkFiles(context.Background(), "/lib", opts, func(dir string, files []FileItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := seen[dir]; ok {
+			t.Errorf("OnDir(%s) called before its files were delivered", dir)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFiles() error = %v", err)
+	}
+
+	if listed["/lib/done"] {
+		t.Error("skipped directory should not be listed")
+	}
+	if got := seen["/lib"]; len(got) != 2 || got[0] != "/lib/done" || got[1] != "/lib/todo" {
+		t.Errorf("expected subdirs of /lib, got %v", got)
+	}
+	if got, ok := seen["/lib/todo"]; !ok || got == nil || len(got) != 0 {
+		t.Errorf("expected empty, non-nil subdirs for leaf, got %v (ok=%v)", got, ok)
+	}
+	if _, ok := seen["/lib/done"]; ok {
+		t.Error("OnDir should not be called for skipped directories")
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// FolderPasswordRequest represents a folder password create/update request
+type FolderPasswordRequest struct {
+	PathPrefix string `json:"path_prefix" binding:"required"` // Alist 路径前缀
+	Password   string `json:"password" binding:"required"`
+	Note       string `json:"note"`
+}
+
+// FolderPasswordResponse represents a folder password; the password itself is never returned
+type FolderPasswordResponse struct {
+	ID         uint      `json:"id"`
+	PathPrefix string    `json:"path_prefix"`
+	Note       string    `json:"note,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// handleListFolderPasswords handles listing folder passwords
+func (s *Server) handleListFolderPasswords(c *gin.Context) {
+	rows, err := s.db.ListFolderPasswords()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list folder passwords"})
+		return
+	}
+
+	response := []FolderPasswordResponse{}
+	for _, row := range rows {
+		response = append(response, FolderPasswordResponse{
+			ID:         row.ID,
+			PathPrefix: row.PathPrefix,
+			Note:       row.Note,
+			UpdatedAt:  row.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folder_passwords": response})
+}
+
+// handleSaveFolderPassword handles creating or replacing the password of a path prefix
+func (s *Server) handleSaveFolderPassword(c *gin.Context) {
+	var req FolderPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !strings.HasPrefix(req.PathPrefix, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path_prefix must be an absolute Alist path"})
+		return
+	}
+
+	encrypted, err := s.box.Encrypt(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt password"})
+		return
+	}
+
+	fp := &storage.FolderPassword{
+		PathPrefix: path.Clean(req.PathPrefix),
+		Password:   encrypted,
+		Note:       req.Note,
+	}
+	if err := s.db.UpsertFolderPassword(fp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save folder password"})
+		return
+	}
+
+	if err := s.scheduler.ReloadFolderPasswords(); err != nil {
+		log.Printf("[API] WARNING: Failed to reload folder passwords: %v", err)
+	}
+
+	c.JSON(http.StatusOK, FolderPasswordResponse{
+		ID:         fp.ID,
+		PathPrefix: fp.PathPrefix,
+		Note:       fp.Note,
+		UpdatedAt:  fp.UpdatedAt,
+	})
+}
+
+// handleDeleteFolderPassword handles deleting a folder password
+func (s *Server) handleDeleteFolderPassword(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder password id"})
+		return
+	}
+
+	if err := s.db.DeleteFolderPassword(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete folder password"})
+		return
+	}
+
+	if err := s.scheduler.ReloadFolderPasswords(); err != nil {
+		log.Printf("[API] WARNING: Failed to reload folder passwords: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "folder password deleted successfully"})
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,22 +14,30 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
 
+	"github.com/konghanghang/openlist-strm/internal/alist"
 	"github.com/konghanghang/openlist-strm/internal/contextkeys"
+	"github.com/konghanghang/openlist-strm/internal/scheduler"
 	"github.com/konghanghang/openlist-strm/internal/storage"
 )
 
 // GenerateRequest represents a generate request
 type GenerateRequest struct {
 	Path string `json:"path"` // Optional, if empty, run all mappings
-	Mode string `json:"mode"` // Optional, default to incremental
+
+	// Optional per-run overrides, default to the mapping's settings
+	Mode       string `json:"mode"`      // incremental or full
+	STRMMode   string `json:"strm_mode"` // alist_path or http_url
+	Concurrent int    `json:"concurrent"`
+	DryRun     bool   `json:"dry_run"` // only report what would change
+	Refresh    bool   `json:"refresh"` // bypass Alist's cache for every listing
 }
 
 // GenerateResponse represents a generate response
 type GenerateResponse struct {
-	TaskID string `json:"task_id"`
-	Status string `json:"status"`
+	TaskID  string   `json:"task_id"`
+	TaskIDs []string `json:"task_ids,omitempty"` // one task per mapping when running all
+	Status  string   `json:"status"`
 }
 
 // TaskResponse represents a task response
@@ -35,6 +45,17 @@ type TaskResponse struct {
 	TaskID       string     `json:"task_id"`
 	ConfigName   string     `json:"config_name"`
 	Mode         string     `json:"mode"`
+	STRMMode     string     `json:"strm_mode,omitempty"`
+	Concurrent   int        `json:"concurrent,omitempty"`
+	DryRun       bool       `json:"dry_run,omitempty"`
+	Refresh      bool       `json:"refresh,omitempty"`
+	Trigger      string     `json:"trigger,omitempty"`
+	Subpaths     []string   `json:"subpaths,omitempty"`
+	Event        string     `json:"event,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	ParentTaskID string     `json:"parent_task_id,omitempty"`
+	Attempt      int        `json:"attempt,omitempty"`
+	FailedPaths  []string   `json:"failed_paths,omitempty"` // only in task details
 	Status       string     `json:"status"`
 	FilesCreated int        `json:"files_created"`
 	FilesDeleted int        `json:"files_deleted"`
@@ -81,17 +102,32 @@ func (s *Server) handleGenerate(c *gin.Context) {
 	}
 
 	// Default mode
-	if req.Mode == "" {
-		req.Mode = "incremental"
-	}
-
-	// Validate mode
-	if req.Mode != "incremental" && req.Mode != "full" {
+	// Validate overrides
+	if req.Mode != "" && req.Mode != "incremental" && req.Mode != "full" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "mode must be 'incremental' or 'full'",
 		})
 		return
 	}
+	if req.STRMMode != "" && req.STRMMode != "alist_path" && req.STRMMode != "http_url" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "strm_mode must be 'alist_path' or 'http_url'",
+		})
+		return
+	}
+	if req.Concurrent < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "concurrent must not be negative",
+		})
+		return
+	}
+	runOpts := scheduler.RunOptions{
+		Mode:       req.Mode,
+		STRMMode:   req.STRMMode,
+		Concurrent: req.Concurrent,
+		DryRun:     req.DryRun,
+		Refresh:    req.Refresh,
+	}
 
 	taskID := uuid.New().String()
 	traceID := taskID[:8]
@@ -99,24 +135,39 @@ func (s *Server) handleGenerate(c *gin.Context) {
 	// Create context with trace ID
 	ctx := context.WithValue(context.Background(), contextkeys.TraceIDKey, taskID)
 
-	log.Printf("[TraceID: %s] API request received: path=%s, mode=%s", traceID, req.Path, req.Mode)
+	log.Printf("[TraceID: %s] API request received: path=%s, mode=%s, strm_mode=%s, concurrent=%d, dry_run=%v, refresh=%v",
+		traceID, req.Path, req.Mode, req.STRMMode, req.Concurrent, req.DryRun, req.Refresh)
 
-	// Run in background
-	go func() {
-		if req.Path == "" {
-			// Run all mappings
-			log.Printf("[TraceID: %s] Running all enabled mappings", traceID)
-			_ = s.scheduler.RunAll(ctx) // Error already logged by RunAll
-		} else {
-			// Run specific mapping
-			log.Printf("[TraceID: %s] Running specific mapping: %s", traceID, req.Path)
-			_ = s.scheduler.RunMappingByName(ctx, req.Path) // Error already logged
+	if req.Path == "" {
+		// Queue all mappings, each with its own task
+		log.Printf("[TraceID: %s] Queueing all enabled mappings", traceID)
+		taskIDs, err := s.scheduler.EnqueueAll(scheduler.TriggerManual, runOpts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
 		}
-	}()
+		resp := GenerateResponse{TaskIDs: taskIDs, Status: storage.TaskStatusQueued}
+		if len(taskIDs) > 0 {
+			resp.TaskID = taskIDs[0]
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// Queue specific mapping
+	log.Printf("[TraceID: %s] Queueing specific mapping: %s", traceID, req.Path)
+	if _, err := s.scheduler.Enqueue(ctx, req.Path, scheduler.TriggerManual, runOpts); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, GenerateResponse{
 		TaskID: taskID,
-		Status: "running",
+		Status: storage.TaskStatusQueued,
 	})
 }
 
@@ -136,6 +187,17 @@ func (s *Server) handleGetTask(c *gin.Context) {
 		TaskID:       task.TaskID,
 		ConfigName:   task.ConfigName,
 		Mode:         task.Mode,
+		STRMMode:     task.STRMMode,
+		Concurrent:   task.Concurrent,
+		DryRun:       task.DryRun,
+		Refresh:      task.Refresh,
+		Trigger:      task.Trigger,
+		Subpaths:     taskSubpaths(task),
+		Event:        task.Event,
+		Type:         task.Type,
+		ParentTaskID: task.ParentTaskID,
+		Attempt:      task.Attempt,
+		FailedPaths:  taskFailedPaths(task),
 		Status:       task.Status,
 		FilesCreated: task.FilesCreated,
 		FilesDeleted: task.FilesDeleted,
@@ -146,6 +208,55 @@ func (s *Server) handleGetTask(c *gin.Context) {
 	})
 }
 
+// handleCancelTask handles cancelling a queued or running task
+func (s *Server) handleCancelTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	status, err := s.scheduler.CancelTask(taskID)
+	switch {
+	case errors.Is(err, scheduler.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "task not found",
+		})
+		return
+	case errors.Is(err, scheduler.ErrTaskNotActive):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"status": status,
+		})
+		return
+	}
+
+	// Running tasks record the cancelled status once they have stopped
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"status":  status,
+		"message": "cancellation requested",
+	})
+}
+
+// handleResumeTask handles resuming a failed, cancelled or interrupted task
+func (s *Server) handleResumeTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	if err := s.scheduler.ResumeTask(taskID); err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrTaskNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		case errors.Is(err, scheduler.ErrTaskNotResumable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, GenerateResponse{
+		TaskID: taskID,
+		Status: storage.TaskStatusQueued,
+	})
+}
+
 // handleListTasks handles list tasks with pagination
 func (s *Server) handleListTasks(c *gin.Context) {
 	// Parse pagination parameters
@@ -185,6 +296,16 @@ func (s *Server) handleListTasks(c *gin.Context) {
 			TaskID:       task.TaskID,
 			ConfigName:   task.ConfigName,
 			Mode:         task.Mode,
+			STRMMode:     task.STRMMode,
+			Concurrent:   task.Concurrent,
+			DryRun:       task.DryRun,
+			Refresh:      task.Refresh,
+			Trigger:      task.Trigger,
+			Subpaths:     taskSubpaths(task),
+			Event:        task.Event,
+			Type:         task.Type,
+			ParentTaskID: task.ParentTaskID,
+			Attempt:      task.Attempt,
 			Status:       task.Status,
 			FilesCreated: task.FilesCreated,
 			FilesDeleted: task.FilesDeleted,
@@ -213,18 +334,7 @@ func (s *Server) handleGetConfigs(c *gin.Context) {
 
 	var configs []MappingResponse
 	for _, m := range mappings {
-		configs = append(configs, MappingResponse{
-			ID:         m.ID,
-			Name:       m.Name,
-			Source:     m.Source,
-			Target:     m.Target,
-			Extensions: strings.Split(m.Extensions, ","),
-			Concurrent: m.Concurrent,
-			Mode:       m.Mode,
-			STRMMode:   m.STRMMode,
-			CronExpr:   m.CronExpr,
-			Enabled:    m.Enabled,
-		})
+		configs = append(configs, newMappingResponse(m))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -243,13 +353,23 @@ func (s *Server) handleGetStatus(c *gin.Context) {
 	})
 }
 
+// handleGetQueue handles listing running and queued tasks
+func (s *Server) handleGetQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, s.scheduler.Queue())
+}
+
 // WebhookRequest represents a webhook request
 type WebhookRequest struct {
 	Path       string `json:"path" binding:"required"` // 网盘原始路径（文件或目录）
 	Event      string `json:"event"`                   // 事件类型（可选）
 	ConfigName string `json:"config_name"`             // 指定配置名称（可选，优先使用）
 	Mode       string `json:"mode"`                    // 执行模式：incremental/full（可选，覆盖配置）
+	STRMMode   string `json:"strm_mode"`               // STRM 模式：alist_path/http_url（可选，覆盖配置）
+	Concurrent int    `json:"concurrent"`              // 并发数（可选，覆盖配置）
+	DryRun     bool   `json:"dry_run"`                 // 仅统计将生成的文件，不写入（可选）
 	Source     string `json:"source"`                  // 来源标识（可选，用于日志）
+	Refresh    bool   `json:"refresh"`                 // 强制刷新相关目录的 Alist 缓存（可选）
+	OldPath    string `json:"old_path"`                // 重命名/移动前的路径（rename 事件必填）
 
 	// 路径映射：网盘路径 -> Alist路径
 	DrivePath string `json:"drive_path"` // 网盘路径前缀（可选）
@@ -262,6 +382,7 @@ type WebhookResponse struct {
 	Message string `json:"message"`
 	Skipped bool   `json:"skipped,omitempty"` // 是否跳过（未匹配到配置）
 	TaskID  string `json:"task_id,omitempty"`
+	EventID uint   `json:"event_id,omitempty"` // 持久化的 Webhook 事件 ID
 }
 
 // convertPath 将网盘路径转换为 Alist 路径
@@ -294,38 +415,36 @@ func convertPath(originalPath, drivePath, alistPath string) (string, bool) {
 	return filepath.Join(alistPath, relPath), true
 }
 
-// matchPath 检查文件路径是否匹配源路径（支持目录和文件）
-func matchPath(filePath, sourcePath string) bool {
-	// 清理路径
-	filePath = filepath.Clean(filePath)
-	sourcePath = filepath.Clean(sourcePath)
-
-	// 精确匹配
-	if filePath == sourcePath {
-		return true
+// taskSubpaths returns the subpaths a task was limited to
+func taskSubpaths(task *storage.Task) []string {
+	if task.Subpaths == "" {
+		return nil
 	}
+	return strings.Split(task.Subpaths, "\n")
+}
 
-	// 前缀匹配 + 确保路径边界
-	if strings.HasPrefix(filePath, sourcePath) {
-		rest := filePath[len(sourcePath):]
-		// 必须是路径分隔符开头，避免 /media/movies-hd 匹配 /media/movies
-		return len(rest) > 0 && rest[0] == byte(filepath.Separator)
+// taskFailedPaths returns the Alist paths of the files a task failed on
+func taskFailedPaths(task *storage.Task) []string {
+	if task.FailedPaths == "" {
+		return nil
 	}
-
-	return false
+	return strings.Split(task.FailedPaths, "\n")
 }
 
-// handleWebhook handles webhook notifications from external systems
-func (s *Server) handleWebhook(c *gin.Context) {
-	var req WebhookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, WebhookResponse{
-			Success: false,
-			Message: "invalid request body",
-		})
-		return
+// webhookEvent 将 Webhook 事件类型归类为删除、移动或新增（空字符串）
+func webhookEvent(event string) string {
+	switch strings.ToLower(event) {
+	case "delete", "deleted", "remove", "removed":
+		return scheduler.EventDelete
+	case "rename", "renamed", "move", "moved":
+		return scheduler.EventMove
 	}
+	return ""
+}
 
+// processWebhook matches a webhook to a mapping and queues its task. It
+// returns the HTTP status and response of the webhook.
+func (s *Server) processWebhook(req WebhookRequest) (int, WebhookResponse) {
 	// 生成 TraceID
 	taskID := uuid.New().String()
 	traceID := taskID[:8]
@@ -334,6 +453,12 @@ func (s *Server) handleWebhook(c *gin.Context) {
 	log.Printf("[TraceID: %s] Webhook received: path=%s, event=%s, source=%s, config_name=%s, mode=%s",
 		traceID, req.Path, req.Event, req.Source, req.ConfigName, req.Mode)
 
+	// 请求未指定路径前缀时使用服务端路径规则
+	useRules := req.DrivePath == "" && req.AlistPath == ""
+	if useRules {
+		req.DrivePath, req.AlistPath = s.pathRulePrefixes(req.Path, req.Source, traceID)
+	}
+
 	// 应用路径转换
 	convertedPath, converted := convertPath(req.Path, req.DrivePath, req.AlistPath)
 	if converted {
@@ -344,63 +469,94 @@ func (s *Server) handleWebhook(c *gin.Context) {
 			traceID, req.Path)
 	}
 
+	// 删除、重命名事件：重命名需要转换旧路径，缺少旧路径时按新增处理
+	event := webhookEvent(req.Event)
+	var convertedOldPath string
+	if event == scheduler.EventMove {
+		if req.OldPath == "" {
+			log.Printf("[TraceID: %s] WARNING: Rename event without old_path, handling as a new path", traceID)
+			event = ""
+		} else {
+			oldDrivePath, oldAlistPath := req.DrivePath, req.AlistPath
+			if useRules {
+				oldDrivePath, oldAlistPath = s.pathRulePrefixes(req.OldPath, req.Source, traceID)
+			}
+			convertedOldPath, _ = convertPath(req.OldPath, oldDrivePath, oldAlistPath)
+		}
+	}
+
 	// 查找匹配的配置
 	var matchedMappingName string
 	var matchedMappingMode string
+	var matchedMappingSource string
 
 	// 优先使用指定的配置名称
 	if req.ConfigName != "" {
 		mapping, err := s.db.GetMappingByName(req.ConfigName)
 		if err != nil {
 			log.Printf("[TraceID: %s] ERROR: Config not found: %s", traceID, req.ConfigName)
-			c.JSON(http.StatusBadRequest, WebhookResponse{
+			return http.StatusBadRequest, WebhookResponse{
 				Success: false,
 				Message: fmt.Sprintf("config not found: %s", req.ConfigName),
-			})
-			return
+			}
 		}
 		if !mapping.Enabled {
 			log.Printf("[TraceID: %s] WARNING: Config is disabled: %s", traceID, req.ConfigName)
-			c.JSON(http.StatusOK, WebhookResponse{
+			return http.StatusOK, WebhookResponse{
 				Success: true,
 				Skipped: true,
 				Message: fmt.Sprintf("config is disabled: %s", req.ConfigName),
-			})
-			return
+			}
 		}
 		matchedMappingName = mapping.Name
 		matchedMappingMode = mapping.Mode
+		matchedMappingSource = mapping.Source
 		log.Printf("[TraceID: %s] Using specified config: %s", traceID, matchedMappingName)
 	} else {
 		// 通过路径匹配查找配置
 		mappings, err := s.db.ListEnabledMappings()
 		if err != nil {
 			log.Printf("[TraceID: %s] ERROR: Failed to list mappings: %v", traceID, err)
-			c.JSON(http.StatusInternalServerError, WebhookResponse{
+			return http.StatusInternalServerError, WebhookResponse{
 				Success: false,
 				Message: "failed to list mappings",
-			})
-			return
+			}
 		}
 
 		for _, mapping := range mappings {
-			if matchPath(convertedPath, mapping.Source) {
+			if alist.IsWithin(convertedPath, mapping.Source) {
 				matchedMappingName = mapping.Name
 				matchedMappingMode = mapping.Mode
+				matchedMappingSource = mapping.Source
 				log.Printf("[TraceID: %s] Matched config by path: %s (source=%s)",
 					traceID, mapping.Name, mapping.Source)
 				break
 			}
 		}
 
+		// 移出所有映射的文件按删除旧路径处理
+		if matchedMappingName == "" && event == scheduler.EventMove {
+			for _, mapping := range mappings {
+				if alist.IsWithin(convertedOldPath, mapping.Source) {
+					matchedMappingName = mapping.Name
+					matchedMappingMode = mapping.Mode
+					matchedMappingSource = mapping.Source
+					log.Printf("[TraceID: %s] Path moved out of config %s, handling as delete of %s",
+						traceID, mapping.Name, convertedOldPath)
+					event = scheduler.EventDelete
+					convertedPath = convertedOldPath
+					break
+				}
+			}
+		}
+
 		if matchedMappingName == "" {
 			log.Printf("[TraceID: %s] No matching config found for path: %s", traceID, convertedPath)
-			c.JSON(http.StatusOK, WebhookResponse{
+			return http.StatusOK, WebhookResponse{
 				Success: true,
 				Skipped: true,
 				Message: "no matching mapping found",
-			})
-			return
+			}
 		}
 	}
 
@@ -417,22 +573,80 @@ func (s *Server) handleWebhook(c *gin.Context) {
 		}
 	}
 
+	// 其他覆盖参数，无效值同样忽略并沿用配置
+	runOpts := scheduler.RunOptions{
+		Mode:   execMode,
+		DryRun: req.DryRun,
+	}
+	if req.STRMMode != "" {
+		if req.STRMMode == "alist_path" || req.STRMMode == "http_url" {
+			runOpts.STRMMode = req.STRMMode
+		} else {
+			log.Printf("[TraceID: %s] WARNING: Invalid strm_mode in webhook: %s, using config value", traceID, req.STRMMode)
+		}
+	}
+	if req.Concurrent > 0 {
+		runOpts.Concurrent = req.Concurrent
+	}
+
 	// 创建 context
 	ctx := context.WithValue(context.Background(), contextkeys.TraceIDKey, taskID)
 
-	log.Printf("[TraceID: %s] Triggering generation: config=%s, mode=%s",
-		traceID, matchedMappingName, execMode)
+	// 只扫描 Webhook 路径对应的目录或文件；路径不在源目录内时扫描整个映射
+	if alist.IsWithin(convertedPath, matchedMappingSource) {
+		runOpts.Subpaths = []string{convertedPath}
+	}
+
+	// 删除事件只处理源目录下的路径；重命名的旧路径不在源目录内时按新增处理
+	inSource := len(runOpts.Subpaths) > 0 && filepath.Clean(convertedPath) != filepath.Clean(matchedMappingSource)
+	switch {
+	case event == scheduler.EventDelete && !inSource:
+		log.Printf("[TraceID: %s] Delete event outside the config source, skipping: %s", traceID, convertedPath)
+		return http.StatusOK, WebhookResponse{
+			Success: true,
+			Skipped: true,
+			Message: "deleted path is not below the mapping source",
+		}
+	case event == scheduler.EventMove && (!inSource || !alist.IsWithin(convertedOldPath, matchedMappingSource) ||
+		filepath.Clean(convertedOldPath) == filepath.Clean(matchedMappingSource)):
+		log.Printf("[TraceID: %s] Old path %s is not below the config source, handling as a new path", traceID, convertedOldPath)
+		event = ""
+	}
+	runOpts.Event = event
+	if event == scheduler.EventMove {
+		runOpts.MovedFrom = convertedOldPath
+	}
+
+	// 刷新 Webhook 路径相关目录的 Alist 缓存，使新文件可见
+	if req.Refresh {
+		runOpts.RefreshPaths = []string{convertedPath}
+	}
 
-	// 后台执行任务
-	go func() {
-		_ = s.scheduler.RunMappingByName(ctx, matchedMappingName) // Error already logged
-	}()
+	log.Printf("[TraceID: %s] Triggering generation: config=%s, event=%s, mode=%s, strm_mode=%s, concurrent=%d, dry_run=%v, refresh=%v",
+		traceID, matchedMappingName, event, execMode, runOpts.STRMMode, runOpts.Concurrent, req.DryRun, req.Refresh)
 
-	c.JSON(http.StatusOK, WebhookResponse{
+	// 加入任务队列，由调度器 worker 执行；合并窗口内的新增 Webhook 共用同一个任务，
+	// 删除、重命名事件单独执行
+	var queuedTaskID string
+	var err error
+	if event != "" {
+		queuedTaskID, err = s.scheduler.Enqueue(ctx, matchedMappingName, scheduler.TriggerWebhook, runOpts)
+	} else {
+		queuedTaskID, err = s.scheduler.EnqueueWebhook(ctx, matchedMappingName, runOpts)
+	}
+	if err != nil {
+		log.Printf("[TraceID: %s] Failed to queue task: %v", traceID, err)
+		return http.StatusInternalServerError, WebhookResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	return http.StatusOK, WebhookResponse{
 		Success: true,
-		Message: "webhook received, generation triggered",
-		TaskID:  taskID,
-	})
+		Message: "webhook received, generation queued",
+		TaskID:  queuedTaskID,
+	}
 }
 
 // MappingRequest represents a mapping create/update request
@@ -446,6 +660,23 @@ type MappingRequest struct {
 	STRMMode   string   `json:"strm_mode"`
 	CronExpr   string   `json:"cron_expr"`
 	Enabled    *bool    `json:"enabled"`
+
+	ListingCache     *bool                 `json:"listing_cache"`
+	DeepScanInterval *int                  `json:"deep_scan_interval"` // hours
+	Discovery        string                `json:"discovery"`          // list or search
+	IndexMaxAge      *int                  `json:"index_max_age"`      // hours, 0 disables the check
+	RefreshPolicy    string                `json:"refresh_policy"`     // never, top, subpath or always
+	RefreshPath      string                `json:"refresh_path"`
+	ConflictPolicy   string                `json:"conflict_policy"` // skip, queue or cancel
+	CatchUpPolicy    string                `json:"catch_up_policy"` // none or once
+	RunOnStartup     *bool                 `json:"run_on_startup"`
+	RunOnChange      *bool                 `json:"run_on_change"`      // run after creation and after source/target/rule edits
+	Timezone         *string               `json:"timezone"`           // IANA name for cron_expr and blackout_windows, empty for local time
+	Jitter           *int                  `json:"jitter"`             // seconds
+	BlackoutWindows  *string               `json:"blackout_windows"`   // e.g. "19:00-23:00,01:00-02:00"
+	FollowUps        *[]scheduler.FollowUp `json:"follow_ups"`         // runs queued when a task of the mapping finishes
+	RetryMaxAttempts *int                  `json:"retry_max_attempts"` // 0 disables retries
+	RetryBackoff     *int                  `json:"retry_backoff"`      // seconds before the first retry, doubled for each further one
 }
 
 // MappingResponse represents a mapping response
@@ -460,6 +691,63 @@ type MappingResponse struct {
 	STRMMode   string   `json:"strm_mode"`
 	CronExpr   string   `json:"cron_expr"`
 	Enabled    bool     `json:"enabled"`
+
+	ListingCache     bool                 `json:"listing_cache"`
+	DeepScanInterval int                  `json:"deep_scan_interval"`
+	LastDeepScanAt   *time.Time           `json:"last_deep_scan_at,omitempty"`
+	Discovery        string               `json:"discovery"`
+	IndexMaxAge      int                  `json:"index_max_age"`
+	RefreshPolicy    string               `json:"refresh_policy"`
+	RefreshPath      string               `json:"refresh_path,omitempty"`
+	ConflictPolicy   string               `json:"conflict_policy"`
+	CatchUpPolicy    string               `json:"catch_up_policy"`
+	LastScheduledAt  *time.Time           `json:"last_scheduled_at,omitempty"`
+	RunOnStartup     bool                 `json:"run_on_startup"`
+	RunOnChange      bool                 `json:"run_on_change"`
+	Timezone         string               `json:"timezone,omitempty"`
+	Jitter           int                  `json:"jitter"`
+	BlackoutWindows  string               `json:"blackout_windows,omitempty"`
+	FollowUps        []scheduler.FollowUp `json:"follow_ups"`
+	RetryMaxAttempts int                  `json:"retry_max_attempts"`
+	RetryBackoff     int                  `json:"retry_backoff"`
+}
+
+// newMappingResponse converts a mapping model into its API representation
+func newMappingResponse(m *storage.Mapping) MappingResponse {
+	followUps, _ := scheduler.ParseFollowUps(m.FollowUps)
+	if followUps == nil {
+		followUps = []scheduler.FollowUp{}
+	}
+	return MappingResponse{
+		ID:               m.ID,
+		Name:             m.Name,
+		Source:           m.Source,
+		Target:           m.Target,
+		Extensions:       strings.Split(m.Extensions, ","),
+		Concurrent:       m.Concurrent,
+		Mode:             m.Mode,
+		STRMMode:         m.STRMMode,
+		CronExpr:         m.CronExpr,
+		Enabled:          m.Enabled,
+		ListingCache:     m.ListingCache,
+		DeepScanInterval: m.DeepScanInterval,
+		LastDeepScanAt:   m.LastDeepScanAt,
+		Discovery:        m.Discovery,
+		IndexMaxAge:      m.IndexMaxAge,
+		RefreshPolicy:    m.RefreshPolicy,
+		RefreshPath:      m.RefreshPath,
+		ConflictPolicy:   m.ConflictPolicy,
+		CatchUpPolicy:    m.CatchUpPolicy,
+		LastScheduledAt:  m.LastScheduledAt,
+		RunOnStartup:     m.RunOnStartup,
+		RunOnChange:      m.RunOnChange,
+		Timezone:         m.Timezone,
+		Jitter:           m.Jitter,
+		BlackoutWindows:  m.BlackoutWindows,
+		FollowUps:        followUps,
+		RetryMaxAttempts: m.RetryMaxAttempts,
+		RetryBackoff:     m.RetryBackoff,
+	}
 }
 
 // handleCreateMapping handles creating a new mapping
@@ -484,6 +772,30 @@ func (s *Server) handleCreateMapping(c *gin.Context) {
 	if req.Enabled != nil {
 		enabled = *req.Enabled
 	}
+	listingCache := false
+	if req.ListingCache != nil {
+		listingCache = *req.ListingCache
+	}
+	deepScanInterval := 24
+	if req.DeepScanInterval != nil {
+		deepScanInterval = *req.DeepScanInterval
+	}
+	if req.Discovery == "" {
+		req.Discovery = "list"
+	}
+	indexMaxAge := 0
+	if req.IndexMaxAge != nil {
+		indexMaxAge = *req.IndexMaxAge
+	}
+	if req.RefreshPolicy == "" {
+		req.RefreshPolicy = scheduler.RefreshNever
+	}
+	if req.ConflictPolicy == "" {
+		req.ConflictPolicy = scheduler.ConflictQueue
+	}
+	if req.CatchUpPolicy == "" {
+		req.CatchUpPolicy = scheduler.CatchUpOnce
+	}
 
 	// Validate mode
 	if req.Mode != "incremental" && req.Mode != "full" {
@@ -494,12 +806,35 @@ func (s *Server) handleCreateMapping(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "strm_mode must be 'alist_path' or 'http_url'"})
 		return
 	}
+	if req.Discovery != "list" && req.Discovery != "search" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discovery must be 'list' or 'search'"})
+		return
+	}
+	if !scheduler.ValidRefreshPolicy(req.RefreshPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_policy must be 'never', 'top', 'subpath' or 'always'"})
+		return
+	}
+	if !scheduler.ValidConflictPolicy(req.ConflictPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "conflict_policy must be 'skip', 'queue' or 'cancel'"})
+		return
+	}
+	if !scheduler.ValidCatchUpPolicy(req.CatchUpPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "catch_up_policy must be 'none' or 'once'"})
+		return
+	}
+	if msg := validateSchedule(req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	followUps, msg := s.encodeFollowUps(req)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
-	// Validate cron expression if provided
-	// Support both 5-field (minute-based) and 6-field (second-based) cron expressions
+	// Validate cron expression if provided, with the parser of the scheduler
 	if req.CronExpr != "" {
-		parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-		if _, err := parser.Parse(req.CronExpr); err != nil {
+		if _, err := scheduler.CronParser.Parse(req.CronExpr); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid cron expression: %v", err)})
 			return
 		}
@@ -515,6 +850,40 @@ func (s *Server) handleCreateMapping(c *gin.Context) {
 		STRMMode:   req.STRMMode,
 		CronExpr:   req.CronExpr,
 		Enabled:    enabled,
+
+		ListingCache:     listingCache,
+		DeepScanInterval: deepScanInterval,
+		Discovery:        req.Discovery,
+		IndexMaxAge:      indexMaxAge,
+		RefreshPolicy:    req.RefreshPolicy,
+		RefreshPath:      req.RefreshPath,
+		ConflictPolicy:   req.ConflictPolicy,
+		CatchUpPolicy:    req.CatchUpPolicy,
+		RunOnStartup:     req.RunOnStartup != nil && *req.RunOnStartup,
+		RunOnChange:      req.RunOnChange != nil && *req.RunOnChange,
+	}
+	if req.Timezone != nil {
+		mapping.Timezone = *req.Timezone
+	}
+	if req.Jitter != nil {
+		mapping.Jitter = *req.Jitter
+	}
+	if req.BlackoutWindows != nil {
+		mapping.BlackoutWindows = *req.BlackoutWindows
+	}
+	if req.FollowUps != nil {
+		mapping.FollowUps = followUps
+	}
+	if req.RetryMaxAttempts != nil {
+		mapping.RetryMaxAttempts = *req.RetryMaxAttempts
+	}
+	if req.RetryBackoff != nil {
+		mapping.RetryBackoff = *req.RetryBackoff
+	}
+	if mapping.CronExpr != "" {
+		// Baseline for detecting slots missed while the process is down
+		now := time.Now()
+		mapping.LastScheduledAt = &now
 	}
 
 	if err := s.db.CreateMapping(mapping); err != nil {
@@ -524,31 +893,25 @@ func (s *Server) handleCreateMapping(c *gin.Context) {
 
 	// Add cron job if enabled and has cron expression
 	if mapping.Enabled && mapping.CronExpr != "" {
-		if err := s.scheduler.AddCronJob(mapping.ID, mapping.Name, mapping.CronExpr); err != nil {
+		if err := s.scheduler.AddCronJob(mapping.ID, mapping.Name, mapping.CronExpr, mapping.Timezone); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("mapping created but failed to add cron job: %v", err)})
 			return
 		}
 	}
 
-	c.JSON(http.StatusCreated, MappingResponse{
-		ID:         mapping.ID,
-		Name:       mapping.Name,
-		Source:     mapping.Source,
-		Target:     mapping.Target,
-		Extensions: req.Extensions,
-		Concurrent: mapping.Concurrent,
-		Mode:       mapping.Mode,
-		STRMMode:   mapping.STRMMode,
-		CronExpr:   mapping.CronExpr,
-		Enabled:    mapping.Enabled,
-	})
+	if mapping.Enabled && mapping.RunOnChange {
+		if _, err := s.scheduler.RunAfterChange(mapping, false); err != nil {
+			log.Printf("[API] WARNING: Failed to queue run for created mapping %s: %v", mapping.Name, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, newMappingResponse(mapping))
 }
 
 // handleUpdateMapping handles updating a mapping
 func (s *Server) handleUpdateMapping(c *gin.Context) {
-	id := c.Param("id")
-	var mappingID uint
-	if _, err := fmt.Sscanf(id, "%d", &mappingID); err != nil {
+	mappingID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mapping id"})
 		return
 	}
@@ -560,12 +923,14 @@ func (s *Server) handleUpdateMapping(c *gin.Context) {
 	}
 
 	// Get existing mapping
-	existing, err := s.db.GetMappingByID(mappingID)
+	existing, err := s.db.GetMappingByID(uint(mappingID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "mapping not found"})
 		return
 	}
 
+	before := *existing
+
 	// Update fields
 	existing.Name = req.Name
 	existing.Source = req.Source
@@ -589,61 +954,193 @@ func (s *Server) handleUpdateMapping(c *gin.Context) {
 		existing.STRMMode = req.STRMMode
 	}
 
-	// Validate and update cron expression
-	// Support both 5-field (minute-based) and 6-field (second-based) cron expressions
+	// Validate and update cron expression, with the parser of the scheduler
+	rescheduled := false
 	if req.CronExpr != existing.CronExpr {
 		if req.CronExpr != "" {
-			parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-			if _, err := parser.Parse(req.CronExpr); err != nil {
+			if _, err := scheduler.CronParser.Parse(req.CronExpr); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid cron expression: %v", err)})
 				return
 			}
 		}
 		existing.CronExpr = req.CronExpr
+		// Slots of the previous expression are not missed runs
+		rescheduled = true
 	}
 
 	if req.Enabled != nil {
 		existing.Enabled = *req.Enabled
 	}
+	if req.ListingCache != nil {
+		existing.ListingCache = *req.ListingCache
+	}
+	if req.DeepScanInterval != nil {
+		existing.DeepScanInterval = *req.DeepScanInterval
+	}
+	if req.Discovery != "" {
+		if req.Discovery != "list" && req.Discovery != "search" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "discovery must be 'list' or 'search'"})
+			return
+		}
+		existing.Discovery = req.Discovery
+	}
+	if req.IndexMaxAge != nil {
+		existing.IndexMaxAge = *req.IndexMaxAge
+	}
+	if req.RefreshPolicy != "" {
+		if !scheduler.ValidRefreshPolicy(req.RefreshPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_policy must be 'never', 'top', 'subpath' or 'always'"})
+			return
+		}
+		existing.RefreshPolicy = req.RefreshPolicy
+		existing.RefreshPath = req.RefreshPath
+	}
+	if req.ConflictPolicy != "" {
+		if !scheduler.ValidConflictPolicy(req.ConflictPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "conflict_policy must be 'skip', 'queue' or 'cancel'"})
+			return
+		}
+		existing.ConflictPolicy = req.ConflictPolicy
+	}
+	if req.CatchUpPolicy != "" {
+		if !scheduler.ValidCatchUpPolicy(req.CatchUpPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "catch_up_policy must be 'none' or 'once'"})
+			return
+		}
+		existing.CatchUpPolicy = req.CatchUpPolicy
+	}
+	if req.RunOnStartup != nil {
+		existing.RunOnStartup = *req.RunOnStartup
+	}
+	if req.RunOnChange != nil {
+		existing.RunOnChange = *req.RunOnChange
+	}
+	if msg := validateSchedule(req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if req.Timezone != nil && *req.Timezone != existing.Timezone {
+		existing.Timezone = *req.Timezone
+		// Slots in the previous timezone are not missed runs
+		rescheduled = true
+	}
+	if req.Jitter != nil {
+		existing.Jitter = *req.Jitter
+	}
+	if req.BlackoutWindows != nil {
+		existing.BlackoutWindows = *req.BlackoutWindows
+	}
+	if req.FollowUps != nil {
+		followUps, msg := s.encodeFollowUps(req)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		existing.FollowUps = followUps
+	}
+	if req.RetryMaxAttempts != nil {
+		existing.RetryMaxAttempts = *req.RetryMaxAttempts
+	}
+	if req.RetryBackoff != nil {
+		existing.RetryBackoff = *req.RetryBackoff
+	}
 
 	if err := s.db.UpdateMapping(existing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update mapping"})
 		return
 	}
+	if rescheduled {
+		now := time.Now()
+		if err := s.db.UpdateMappingScheduledAt(existing.ID, now); err != nil {
+			log.Printf("[API] WARNING: Failed to reset schedule baseline of mapping %s: %v", existing.Name, err)
+		}
+		existing.LastScheduledAt = &now
+	}
 
 	// Update cron job
-	if err := s.scheduler.UpdateCronJob(existing.ID, existing.Name, existing.CronExpr, existing.Enabled); err != nil {
+	if err := s.scheduler.UpdateCronJob(existing.ID, existing.Name, existing.CronExpr, existing.Timezone, existing.Enabled); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("mapping updated but failed to update cron job: %v", err)})
 		return
 	}
 
-	c.JSON(http.StatusOK, MappingResponse{
-		ID:         existing.ID,
-		Name:       existing.Name,
-		Source:     existing.Source,
-		Target:     existing.Target,
-		Extensions: strings.Split(existing.Extensions, ","),
-		Concurrent: existing.Concurrent,
-		Mode:       existing.Mode,
-		STRMMode:   existing.STRMMode,
-		CronExpr:   existing.CronExpr,
-		Enabled:    existing.Enabled,
-	})
+	if existing.Enabled && existing.RunOnChange && mappingRulesChanged(&before, existing) {
+		if _, err := s.scheduler.RunAfterChange(existing, existing.Target != before.Target); err != nil {
+			log.Printf("[API] WARNING: Failed to queue run for edited mapping %s: %v", existing.Name, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, newMappingResponse(existing))
+}
+
+// validateSchedule checks the timezone, jitter, blackout windows, retry
+// policy and deep scan interval of a mapping request, returning an error message
+func validateSchedule(req MappingRequest) string {
+	if req.Timezone != nil {
+		if _, err := scheduler.LoadTimezone(*req.Timezone); err != nil {
+			return fmt.Sprintf("invalid timezone: %s", *req.Timezone)
+		}
+	}
+	if req.Jitter != nil && *req.Jitter < 0 {
+		return "jitter must not be negative"
+	}
+	if req.BlackoutWindows != nil {
+		if err := scheduler.ValidateBlackoutWindows(*req.BlackoutWindows); err != nil {
+			return err.Error()
+		}
+	}
+	if req.RetryMaxAttempts != nil && *req.RetryMaxAttempts < 0 {
+		return "retry_max_attempts must not be negative"
+	}
+	if req.RetryBackoff != nil && *req.RetryBackoff <= 0 {
+		return "retry_backoff must be positive"
+	}
+	if req.DeepScanInterval != nil && *req.DeepScanInterval <= 0 {
+		return "deep_scan_interval must be positive"
+	}
+	return ""
+}
+
+// encodeFollowUps checks the follow-ups of a mapping request and returns
+// them as stored on the mapping, or an error message
+func (s *Server) encodeFollowUps(req MappingRequest) (string, string) {
+	if req.FollowUps == nil || len(*req.FollowUps) == 0 {
+		return "", ""
+	}
+	for _, f := range *req.FollowUps {
+		if err := scheduler.ValidateFollowUp(f); err != nil {
+			return "", err.Error()
+		}
+		if f.Mapping != "" && f.Mapping != req.Name {
+			if _, err := s.db.GetMappingByName(f.Mapping); err != nil {
+				return "", fmt.Sprintf("follow-up mapping not found: %s", f.Mapping)
+			}
+		}
+	}
+	data, _ := json.Marshal(*req.FollowUps)
+	return string(data), ""
+}
+
+// mappingRulesChanged reports whether an edit changed what a mapping
+// generates: its source, target or file rules
+func mappingRulesChanged(before, after *storage.Mapping) bool {
+	return before.Source != after.Source ||
+		before.Target != after.Target ||
+		before.Extensions != after.Extensions ||
+		before.STRMMode != after.STRMMode
 }
 
 // handleDeleteMapping handles deleting a mapping
 func (s *Server) handleDeleteMapping(c *gin.Context) {
-	id := c.Param("id")
-	var mappingID uint
-	if _, err := fmt.Sscanf(id, "%d", &mappingID); err != nil {
+	mappingID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mapping id"})
 		return
 	}
 
 	// Remove cron job first
-	s.scheduler.RemoveCronJob(mappingID)
+	s.scheduler.RemoveCronJob(uint(mappingID))
 
-	if err := s.db.DeleteMapping(mappingID); err != nil {
+	if err := s.db.DeleteMapping(uint(mappingID)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete mapping"})
 		return
 	}
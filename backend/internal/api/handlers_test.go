@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/scheduler"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestUpdateMapping_KeepsSchedulerState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	cfg := &config.Config{}
+	sched := scheduler.New(cfg, alist.NewClient("http://alist", "", false, time.Second), nil, db, nil)
+	server := &Server{cfg: cfg, db: db, scheduler: sched}
+
+	mapping := &storage.Mapping{Name: "movies", Source: "/src", Target: "/dst", CronExpr: "0 0 3 * * *", Enabled: true, DeepScanInterval: 12}
+	if err := db.CreateMapping(mapping); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	// A run finishes after the handler read the mapping
+	recorded := false
+	err = db.DB.Callback().Query().After("gorm:query").Register("test:run_finished", func(tx *gorm.DB) {
+		if recorded {
+			return
+		}
+		recorded = true
+		db.UpdateMappingScheduledAt(mapping.ID, time.Unix(1000, 0))
+		db.UpdateMappingDeepScan(mapping.ID, time.Unix(2000, 0))
+	})
+	if err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	router := gin.New()
+	router.PUT("/mappings/:id", server.handleUpdateMapping)
+
+	update := func(body string) *storage.Mapping {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/mappings/1", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("update: %d %s", w.Code, w.Body.String())
+		}
+		got, err := db.GetMappingByID(mapping.ID)
+		if err != nil {
+			t.Fatalf("failed to get mapping: %v", err)
+		}
+		return got
+	}
+
+	// Omitted deep_scan_interval keeps the stored one
+	got := update(`{"name":"movies","source":"/src","target":"/other","extensions":["mkv"],"cron_expr":"0 0 3 * * *"}`)
+	if got.DeepScanInterval != 12 || got.Target != "/other" {
+		t.Errorf("deep_scan_interval = %d, target = %s, want 12, /other", got.DeepScanInterval, got.Target)
+	}
+	if got.LastScheduledAt == nil || got.LastScheduledAt.Unix() != 1000 || got.LastDeepScanAt == nil || got.LastDeepScanAt.Unix() != 2000 {
+		t.Errorf("scheduler state overwritten: last_scheduled_at = %v, last_deep_scan_at = %v", got.LastScheduledAt, got.LastDeepScanAt)
+	}
+
+	// A new cron expression resets the catch-up baseline
+	got = update(`{"name":"movies","source":"/src","target":"/other","extensions":["mkv"],"cron_expr":"0 0 4 * * *","deep_scan_interval":6}`)
+	if got.DeepScanInterval != 6 {
+		t.Errorf("deep_scan_interval = %d, want 6", got.DeepScanInterval)
+	}
+	if got.LastScheduledAt == nil || time.Since(*got.LastScheduledAt) > time.Minute {
+		t.Errorf("last_scheduled_at = %v, want now", got.LastScheduledAt)
+	}
+	if got.LastDeepScanAt == nil || got.LastDeepScanAt.Unix() != 2000 {
+		t.Errorf("last_deep_scan_at = %v, want kept", got.LastDeepScanAt)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/mappings/1", strings.NewReader(`{"name":"movies","source":"/src","target":"/other","extensions":["mkv"],"deep_scan_interval":0}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("deep_scan_interval 0: status = %d, want 400", w.Code)
+	}
+
+	// Ids with trailing characters are rejected like any other invalid id
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/mappings/1abc", strings.NewReader(`{"name":"movies","source":"/src","target":"/other","extensions":["mkv"]}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid mapping id") {
+		t.Errorf("id 1abc: %d %s, want 400 invalid mapping id", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// PathRuleRequest represents a path rule create/update request
+type PathRuleRequest struct {
+	Name        string `json:"name" binding:"required"`
+	DrivePrefix string `json:"drive_prefix" binding:"required"` // 网盘/下载器路径前缀
+	AlistPrefix string `json:"alist_prefix" binding:"required"` // Alist 路径前缀
+	Source      string `json:"source"`                          // 仅对该来源生效（可选）
+	Enabled     *bool  `json:"enabled"`
+}
+
+// PathRuleResponse represents a path rule
+type PathRuleResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	DrivePrefix string    `json:"drive_prefix"`
+	AlistPrefix string    `json:"alist_prefix"`
+	Source      string    `json:"source,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func pathRuleResponse(rule *storage.PathRule) PathRuleResponse {
+	return PathRuleResponse{
+		ID:          rule.ID,
+		Name:        rule.Name,
+		DrivePrefix: rule.DrivePrefix,
+		AlistPrefix: rule.AlistPrefix,
+		Source:      rule.Source,
+		Enabled:     rule.Enabled,
+		UpdatedAt:   rule.UpdatedAt,
+	}
+}
+
+// matchPathRule returns the enabled rule for p sent by source: the one with
+// the longest matching drive prefix, preferring rules for that source
+func matchPathRule(rules []*storage.PathRule, p, source string) *storage.PathRule {
+	var best *storage.PathRule
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.Source != "" && rule.Source != source) || !alist.IsWithin(p, rule.DrivePrefix) {
+			continue
+		}
+		if best == nil || len(rule.DrivePrefix) > len(best.DrivePrefix) ||
+			(len(rule.DrivePrefix) == len(best.DrivePrefix) && best.Source == "" && rule.Source != "") {
+			best = rule
+		}
+	}
+	return best
+}
+
+// pathRulePrefixes returns the drive and Alist prefixes of the rule matching
+// p, or empty strings when no rule matches
+func (s *Server) pathRulePrefixes(p, source, traceID string) (string, string) {
+	rules, err := s.db.ListPathRules()
+	if err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to load path rules: %v", traceID, err)
+		return "", ""
+	}
+	rule := matchPathRule(rules, p, source)
+	if rule == nil {
+		return "", ""
+	}
+	log.Printf("[TraceID: %s] Using path rule %s: %s -> %s", traceID, rule.Name, rule.DrivePrefix, rule.AlistPrefix)
+	return rule.DrivePrefix, rule.AlistPrefix
+}
+
+// validatePathRule normalizes and checks the prefixes of a request
+func validatePathRule(req *PathRuleRequest) error {
+	if !strings.HasPrefix(req.DrivePrefix, "/") || !strings.HasPrefix(req.AlistPrefix, "/") {
+		return fmt.Errorf("drive_prefix and alist_prefix must be absolute paths")
+	}
+	req.DrivePrefix = path.Clean(req.DrivePrefix)
+	req.AlistPrefix = path.Clean(req.AlistPrefix)
+	return nil
+}
+
+// handleListPathRules handles listing path rules
+func (s *Server) handleListPathRules(c *gin.Context) {
+	rules, err := s.db.ListPathRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list path rules"})
+		return
+	}
+
+	response := []PathRuleResponse{}
+	for _, rule := range rules {
+		response = append(response, pathRuleResponse(rule))
+	}
+	c.JSON(http.StatusOK, gin.H{"path_rules": response})
+}
+
+// handleCreatePathRule handles creating a path rule
+func (s *Server) handleCreatePathRule(c *gin.Context) {
+	var req PathRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePathRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.db.GetPathRuleByName(req.Name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("path rule already exists: %s", req.Name)})
+		return
+	}
+
+	rule := &storage.PathRule{
+		Name:        req.Name,
+		DrivePrefix: req.DrivePrefix,
+		AlistPrefix: req.AlistPrefix,
+		Source:      req.Source,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if err := s.db.CreatePathRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create path rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, pathRuleResponse(rule))
+}
+
+// handleUpdatePathRule handles updating a path rule
+func (s *Server) handleUpdatePathRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path rule id"})
+		return
+	}
+
+	var req PathRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePathRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := s.db.GetPathRuleByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "path rule not found"})
+		return
+	}
+	if other, err := s.db.GetPathRuleByName(req.Name); err == nil && other.ID != rule.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("path rule already exists: %s", req.Name)})
+		return
+	}
+
+	rule.Name = req.Name
+	rule.DrivePrefix = req.DrivePrefix
+	rule.AlistPrefix = req.AlistPrefix
+	rule.Source = req.Source
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := s.db.UpdatePathRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update path rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pathRuleResponse(rule))
+}
+
+// handleDeletePathRule handles deleting a path rule
+func (s *Server) handleDeletePathRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path rule id"})
+		return
+	}
+
+	if err := s.db.DeletePathRule(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete path rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "path rule deleted successfully"})
+}
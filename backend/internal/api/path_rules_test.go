@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestMatchPathRule(t *testing.T) {
+	rules := []*storage.PathRule{
+		{Name: "all", DrivePrefix: "/mnt/drive", AlistPrefix: "/alist", Enabled: true},
+		{Name: "movies", DrivePrefix: "/mnt/drive/movies", AlistPrefix: "/115/movies", Enabled: true},
+		{Name: "radarr", DrivePrefix: "/mnt/drive/movies", AlistPrefix: "/radarr", Source: "radarr", Enabled: true},
+		{Name: "disabled", DrivePrefix: "/mnt/drive/movies/new", AlistPrefix: "/new", Enabled: false},
+	}
+	tests := []struct {
+		path   string
+		source string
+		want   string
+	}{
+		{"/mnt/drive/tv/show.mkv", "", "all"},
+		{"/mnt/drive/movies/new/a.mkv", "", "movies"},
+		{"/mnt/drive/movies/a.mkv", "radarr", "radarr"},
+		{"/mnt/drive/movies/a.mkv", "sonarr", "movies"},
+		{"/mnt/drive2/a.mkv", "", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if rule := matchPathRule(rules, tt.path, tt.source); rule != nil {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("matchPathRule(%q, %q) = %q, want %q", tt.path, tt.source, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,18 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
 	"github.com/konghanghang/openlist-strm/internal/config"
 	"github.com/konghanghang/openlist-strm/internal/scheduler"
+	"github.com/konghanghang/openlist-strm/internal/secrets"
 	"github.com/konghanghang/openlist-strm/internal/storage"
 )
 
@@ -14,11 +21,19 @@ type Server struct {
 	cfg       *config.Config
 	scheduler *scheduler.Scheduler
 	db        *storage.DB
+	box       *secrets.Box
 	router    *gin.Engine
+	http      *http.Server
+
+	inboxStop chan struct{} // stops the webhook inbox
+	inboxWG   sync.WaitGroup
+
+	signatureMu    sync.Mutex
+	usedSignatures map[string]time.Time // accepted webhook signatures until their timestamp expires
 }
 
 // NewServer creates a new API server
-func NewServer(cfg *config.Config, sched *scheduler.Scheduler, db *storage.DB) *Server {
+func NewServer(cfg *config.Config, sched *scheduler.Scheduler, db *storage.DB, box *secrets.Box) *Server {
 	// Set Gin mode
 	if cfg.Log.Level != "debug" {
 		gin.SetMode(gin.ReleaseMode)
@@ -39,7 +54,10 @@ func NewServer(cfg *config.Config, sched *scheduler.Scheduler, db *storage.DB) *
 		cfg:       cfg,
 		scheduler: sched,
 		db:        db,
+		box:       box,
 		router:    router,
+		http:      &http.Server{Addr: cfg.GetAddr(), Handler: router},
+		inboxStop: make(chan struct{}),
 	}
 
 	s.setupRoutes()
@@ -63,6 +81,8 @@ func (s *Server) setupRoutes() {
 		// Task routes
 		api.POST("/generate", s.handleGenerate)
 		api.GET("/tasks/:id", s.handleGetTask)
+		api.POST("/tasks/:id/cancel", s.handleCancelTask)
+		api.POST("/tasks/:id/resume", s.handleResumeTask)
 		api.GET("/tasks", s.handleListTasks)
 
 		// Config routes
@@ -71,15 +91,55 @@ func (s *Server) setupRoutes() {
 		api.PUT("/configs/:id", s.handleUpdateMapping)
 		api.DELETE("/configs/:id", s.handleDeleteMapping)
 		api.GET("/status", s.handleGetStatus)
+		api.GET("/queue", s.handleGetQueue)
+
+		// Folder password routes
+		api.GET("/folder-passwords", s.handleListFolderPasswords)
+		api.POST("/folder-passwords", s.handleSaveFolderPassword)
+		api.DELETE("/folder-passwords/:id", s.handleDeleteFolderPassword)
+
+		// Path rule routes
+		api.GET("/path-rules", s.handleListPathRules)
+		api.POST("/path-rules", s.handleCreatePathRule)
+		api.PUT("/path-rules/:id", s.handleUpdatePathRule)
+		api.DELETE("/path-rules/:id", s.handleDeletePathRule)
+
+		// Webhook management routes
+		api.GET("/webhooks/events", s.handleListWebhookEvents)
+		api.POST("/webhooks/events/:id/replay", s.handleReplayWebhookEvent)
+		api.GET("/webhooks/secrets", s.handleListWebhookSecrets)
+		api.POST("/webhooks/secrets", s.handleGenerateWebhookSecret)
+		api.DELETE("/webhooks/secrets/:id", s.handleDeleteWebhookSecret)
+	}
 
-		// Webhook routes
-		api.POST("/webhook", s.handleWebhook)
+	// Webhook routes accept the API token or a signature with the secret of
+	// their source
+	webhook := s.router.Group("/api/webhook")
+	{
+		webhook.POST("", s.webhookAuthMiddleware(""), s.handleWebhook)
+		webhook.POST("/sonarr", s.webhookAuthMiddleware("sonarr"), s.handleSonarrWebhook)
+		webhook.POST("/radarr", s.webhookAuthMiddleware("radarr"), s.handleRadarrWebhook)
+		webhook.POST("/qbittorrent", s.webhookAuthMiddleware("qbittorrent"), s.handleQBittorrentWebhook)
+		webhook.POST("/clouddrive2", s.webhookAuthMiddleware("clouddrive2"), s.handleCloudDrive2Webhook)
 	}
 }
 
 // Run starts the API server
 func (s *Server) Run() error {
-	return s.router.Run(s.cfg.GetAddr())
+	s.startWebhookInbox()
+	if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, waits for active ones to finish and
+// stops the webhook inbox
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	close(s.inboxStop)
+	s.inboxWG.Wait()
+	return err
 }
 
 // GetRouter returns the gin router
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/scheduler"
+)
+
+// WebhookAdapterOptions are query parameters shared by the adapter
+// endpoints, applied to every path extracted from the payload
+type WebhookAdapterOptions struct {
+	ConfigName string `form:"config_name"` // 指定配置名称（可选）
+	DrivePath  string `form:"drive_path"`  // 网盘/下载器路径前缀（可选）
+	AlistPath  string `form:"alist_path"`  // Alist 路径前缀（可选）
+	Refresh    bool   `form:"refresh"`     // 强制刷新相关目录的 Alist 缓存（可选）
+}
+
+// request builds a webhook request for path with the shared options
+func (o WebhookAdapterOptions) request(source, event, p, oldPath string) WebhookRequest {
+	return WebhookRequest{
+		Path:       p,
+		OldPath:    oldPath,
+		Event:      event,
+		Source:     source,
+		ConfigName: o.ConfigName,
+		DrivePath:  o.DrivePath,
+		AlistPath:  o.AlistPath,
+		Refresh:    o.Refresh,
+	}
+}
+
+// WebhookBatchResponse represents the response of an adapter endpoint; a
+// payload may describe several files
+type WebhookBatchResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Results []WebhookResponse `json:"results"`
+}
+
+// arrFile is a media file in a Sonarr/Radarr payload
+type arrFile struct {
+	Path         string `json:"path"`
+	RelativePath string `json:"relativePath"`
+}
+
+// arrRenamedFile is a renamed media file in a Sonarr/Radarr payload
+type arrRenamedFile struct {
+	Path         string `json:"path"`
+	PreviousPath string `json:"previousPath"`
+}
+
+// SonarrPayload is the subset of a Sonarr webhook used here
+type SonarrPayload struct {
+	EventType string `json:"eventType"`
+	Series    struct {
+		Path string `json:"path"`
+	} `json:"series"`
+	EpisodeFile         *arrFile         `json:"episodeFile"`
+	DeletedFiles        []arrFile        `json:"deletedFiles"`
+	RenamedEpisodeFiles []arrRenamedFile `json:"renamedEpisodeFiles"`
+}
+
+// RadarrPayload is the subset of a Radarr webhook used here
+type RadarrPayload struct {
+	EventType string `json:"eventType"`
+	Movie     struct {
+		FolderPath string `json:"folderPath"`
+	} `json:"movie"`
+	MovieFile         *arrFile         `json:"movieFile"`
+	DeletedFiles      []arrFile        `json:"deletedFiles"`
+	RenamedMovieFiles []arrRenamedFile `json:"renamedMovieFiles"`
+}
+
+// QBittorrentPayload holds the parameters of qBittorrent's "run external
+// program on torrent finished", sent as JSON, form or query parameters
+type QBittorrentPayload struct {
+	ContentPath string `json:"content_path" form:"content_path"` // %F
+	RootPath    string `json:"root_path" form:"root_path"`       // %R
+	SavePath    string `json:"save_path" form:"save_path"`       // %D
+	Name        string `json:"name" form:"name"`                 // %N
+	Category    string `json:"category" form:"category"`         // %L
+}
+
+// CloudDrive2Payload is a CloudDrive2 file change notification
+type CloudDrive2Payload struct {
+	EventCategory string              `json:"event_category"`
+	EventName     string              `json:"event_name"`
+	Data          []CloudDrive2Change `json:"data"`
+}
+
+// CloudDrive2Change is a single change in a CloudDrive2 notification
+type CloudDrive2Change struct {
+	Action          string `json:"action"` // create, delete, rename
+	IsDir           string `json:"is_dir"`
+	SourceFile      string `json:"source_file"`
+	DestinationFile string `json:"destination_file"`
+}
+
+// arrRequests converts a Sonarr/Radarr event into webhook requests; folder
+// is the series or movie folder
+func arrRequests(source string, opts WebhookAdapterOptions, eventType, folder string, file *arrFile, deleted []arrFile, renamed []arrRenamedFile) ([]WebhookRequest, error) {
+	filePath := func(f *arrFile) string {
+		if f == nil {
+			return ""
+		}
+		if f.Path != "" {
+			return f.Path
+		}
+		if f.RelativePath != "" && folder != "" {
+			return path.Join(folder, f.RelativePath)
+		}
+		return ""
+	}
+
+	var reqs []WebhookRequest
+	switch eventType {
+	case "Download":
+		p := filePath(file)
+		if p == "" {
+			p = folder
+		}
+		if p == "" {
+			return nil, fmt.Errorf("%s download event without a file or folder path", source)
+		}
+		// Files replaced by an upgrade; a file with the same base name keeps
+		// its sidecars and only gets a new STRM
+		for i := range deleted {
+			old := filePath(&deleted[i])
+			if old != "" && strings.TrimSuffix(old, path.Ext(old)) != strings.TrimSuffix(p, path.Ext(p)) {
+				reqs = append(reqs, opts.request(source, scheduler.EventDelete, old, ""))
+			}
+		}
+		reqs = append(reqs, opts.request(source, "download", p, ""))
+	case "Rename":
+		for _, f := range renamed {
+			reqs = append(reqs, opts.request(source, scheduler.EventMove, f.Path, f.PreviousPath))
+		}
+		if len(reqs) == 0 && folder != "" {
+			reqs = append(reqs, opts.request(source, "rename", folder, ""))
+		}
+	case "EpisodeFileDelete", "MovieFileDelete":
+		if p := filePath(file); p != "" {
+			reqs = append(reqs, opts.request(source, scheduler.EventDelete, p, ""))
+		}
+	case "SeriesDelete", "MovieDelete":
+		if folder != "" {
+			reqs = append(reqs, opts.request(source, scheduler.EventDelete, folder, ""))
+		}
+	}
+	return reqs, nil
+}
+
+// handleSonarrWebhook handles Sonarr's Connect → Webhook notifications
+func (s *Server) handleSonarrWebhook(c *gin.Context) {
+	var payload SonarrPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sonarr payload"})
+		return
+	}
+	var opts WebhookAdapterOptions
+	_ = c.ShouldBindQuery(&opts)
+
+	reqs, err := arrRequests("sonarr", opts, payload.EventType, payload.Series.Path,
+		payload.EpisodeFile, payload.DeletedFiles, payload.RenamedEpisodeFiles)
+	s.respondAdapter(c, "sonarr", payload.EventType, reqs, err)
+}
+
+// handleRadarrWebhook handles Radarr's Connect → Webhook notifications
+func (s *Server) handleRadarrWebhook(c *gin.Context) {
+	var payload RadarrPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid radarr payload"})
+		return
+	}
+	var opts WebhookAdapterOptions
+	_ = c.ShouldBindQuery(&opts)
+
+	reqs, err := arrRequests("radarr", opts, payload.EventType, payload.Movie.FolderPath,
+		payload.MovieFile, payload.DeletedFiles, payload.RenamedMovieFiles)
+	s.respondAdapter(c, "radarr", payload.EventType, reqs, err)
+}
+
+// handleQBittorrentWebhook handles qBittorrent completion callbacks, e.g.
+// curl -X POST "http://host:8080/api/webhook/qbittorrent?content_path=%F"
+func (s *Server) handleQBittorrentWebhook(c *gin.Context) {
+	var payload QBittorrentPayload
+	_ = c.ShouldBindQuery(&payload)
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid qbittorrent payload"})
+			return
+		}
+	}
+	var opts WebhookAdapterOptions
+	_ = c.ShouldBindQuery(&opts)
+
+	p := payload.ContentPath
+	if p == "" {
+		p = payload.RootPath
+	}
+	if p == "" && payload.SavePath != "" && payload.Name != "" {
+		p = path.Join(payload.SavePath, payload.Name)
+	}
+	if p == "" {
+		s.respondAdapter(c, "qbittorrent", "finished", nil, fmt.Errorf("content_path, root_path or save_path and name are required"))
+		return
+	}
+	s.respondAdapter(c, "qbittorrent", "finished", []WebhookRequest{opts.request("qbittorrent", "download", p, "")}, nil)
+}
+
+// handleCloudDrive2Webhook handles CloudDrive2 file change notifications
+func (s *Server) handleCloudDrive2Webhook(c *gin.Context) {
+	var payload CloudDrive2Payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid clouddrive2 payload"})
+		return
+	}
+	var opts WebhookAdapterOptions
+	_ = c.ShouldBindQuery(&opts)
+
+	reqs := cloudDrive2Requests(opts, payload.Data, s.videoExtensions())
+	s.respondAdapter(c, "clouddrive2", payload.EventName, reqs, nil)
+}
+
+// cloudDrive2Requests converts CloudDrive2 changes into webhook requests.
+// Changes of files that are not videos (subtitles, artwork, temporary
+// files) are dropped: a deleted subtitle must not remove the STRM file of
+// its video.
+func cloudDrive2Requests(opts WebhookAdapterOptions, changes []CloudDrive2Change, extensions []string) []WebhookRequest {
+	isVideo := func(p string) bool {
+		f := alist.FileItem{Name: path.Base(p)}
+		return f.IsVideo(extensions)
+	}
+
+	var reqs []WebhookRequest
+	for _, change := range changes {
+		if !strings.EqualFold(change.IsDir, "true") && !isVideo(change.SourceFile) && !isVideo(change.DestinationFile) {
+			continue
+		}
+		switch strings.ToLower(change.Action) {
+		case "create":
+			reqs = append(reqs, opts.request("clouddrive2", "create", change.SourceFile, ""))
+		case "delete":
+			reqs = append(reqs, opts.request("clouddrive2", scheduler.EventDelete, change.SourceFile, ""))
+		case "rename", "move":
+			reqs = append(reqs, opts.request("clouddrive2", scheduler.EventMove, change.DestinationFile, change.SourceFile))
+		}
+	}
+	return reqs
+}
+
+// videoExtensions returns the video extensions of all mappings, or the
+// default ones when none can be read
+func (s *Server) videoExtensions() []string {
+	raw := "mp4,mkv,avi"
+	if mappings, err := s.db.ListMappings(); err == nil && len(mappings) > 0 {
+		var all []string
+		for _, m := range mappings {
+			all = append(all, m.Extensions)
+		}
+		raw = strings.Join(all, ",")
+	}
+
+	var extensions []string
+	for _, ext := range strings.Split(raw, ",") {
+		if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// respondAdapter feeds the requests extracted by an adapter into the
+// webhook pipeline and writes the combined response
+func (s *Server) respondAdapter(c *gin.Context, source, eventType string, reqs []WebhookRequest, err error) {
+	var valid []WebhookRequest
+	for _, req := range reqs {
+		if req.Path != "" {
+			valid = append(valid, req)
+		}
+	}
+	reqs = valid
+
+	if err != nil {
+		log.Printf("[Webhook] Invalid %s webhook: %v", source, err)
+		c.JSON(http.StatusBadRequest, WebhookBatchResponse{Success: false, Message: err.Error(), Results: []WebhookResponse{}})
+		return
+	}
+	if len(reqs) == 0 {
+		// Test events and events without files (grab, health, ...)
+		log.Printf("[Webhook] %s event %q has no file changes, ignoring", source, eventType)
+		c.JSON(http.StatusOK, WebhookBatchResponse{
+			Success: true,
+			Message: fmt.Sprintf("%s event %q ignored", source, eventType),
+			Results: []WebhookResponse{},
+		})
+		return
+	}
+
+	log.Printf("[Webhook] %s event %q: %d file changes", source, eventType, len(reqs))
+	resp := WebhookBatchResponse{Success: true, Message: "webhook received", Results: make([]WebhookResponse, 0, len(reqs))}
+	for _, req := range reqs {
+		status, result := s.acceptWebhook(req)
+		if status >= http.StatusBadRequest {
+			resp.Success = false
+			resp.Message = "some changes could not be handled"
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	c.JSON(http.StatusOK, resp)
+}
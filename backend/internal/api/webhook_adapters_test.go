@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/scheduler"
+)
+
+func TestArrRequests(t *testing.T) {
+	opts := WebhookAdapterOptions{ConfigName: "tv"}
+	tests := []struct {
+		name      string
+		eventType string
+		file      *arrFile
+		deleted   []arrFile
+		renamed   []arrRenamedFile
+		want      []WebhookRequest
+	}{
+		{
+			name:      "download with upgrade",
+			eventType: "Download",
+			file:      &arrFile{RelativePath: "Season 1/e01.1080p.mkv"},
+			deleted:   []arrFile{{Path: "/tv/Show/Season 1/e01.720p.mkv"}, {Path: "/tv/Show/Season 1/e01.1080p.mp4"}},
+			want: []WebhookRequest{
+				{Path: "/tv/Show/Season 1/e01.720p.mkv", Event: scheduler.EventDelete},
+				{Path: "/tv/Show/Season 1/e01.1080p.mkv", Event: "download"},
+			},
+		},
+		{
+			name:      "rename",
+			eventType: "Rename",
+			renamed:   []arrRenamedFile{{Path: "/tv/Show/S01E01.mkv", PreviousPath: "/tv/Show/e01.mkv"}},
+			want:      []WebhookRequest{{Path: "/tv/Show/S01E01.mkv", OldPath: "/tv/Show/e01.mkv", Event: scheduler.EventMove}},
+		},
+		{
+			name:      "file delete",
+			eventType: "EpisodeFileDelete",
+			file:      &arrFile{Path: "/tv/Show/e01.mkv"},
+			want:      []WebhookRequest{{Path: "/tv/Show/e01.mkv", Event: scheduler.EventDelete}},
+		},
+		{
+			name:      "series delete",
+			eventType: "SeriesDelete",
+			want:      []WebhookRequest{{Path: "/tv/Show", Event: scheduler.EventDelete}},
+		},
+		{name: "test", eventType: "Test"},
+		{name: "grab", eventType: "Grab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := arrRequests("sonarr", opts, tt.eventType, "/tv/Show", tt.file, tt.deleted, tt.renamed)
+			if err != nil {
+				t.Fatalf("arrRequests() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("arrRequests() = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if got[i].Path != want.Path || got[i].OldPath != want.OldPath || got[i].Event != want.Event {
+					t.Errorf("request %d = %+v, want %+v", i, got[i], want)
+				}
+				if got[i].ConfigName != "tv" || got[i].Source != "sonarr" {
+					t.Errorf("request %d lost shared options: %+v", i, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCloudDrive2Requests(t *testing.T) {
+	changes := []CloudDrive2Change{
+		{Action: "create", IsDir: "false", SourceFile: "/cd2/Movie.mkv"},
+		{Action: "delete", IsDir: "false", SourceFile: "/cd2/Movie.srt"},
+		{Action: "delete", IsDir: "false", SourceFile: "/cd2/Movie-poster.jpg"},
+		{Action: "delete", IsDir: "true", SourceFile: "/cd2/Show"},
+		{Action: "rename", IsDir: "false", SourceFile: "/cd2/a.srt", DestinationFile: "/cd2/b.srt"},
+		{Action: "rename", IsDir: "false", SourceFile: "/cd2/a.mp4", DestinationFile: "/cd2/b.mp4"},
+	}
+	got := cloudDrive2Requests(WebhookAdapterOptions{}, changes, []string{"mkv", "mp4"})
+
+	var paths []string
+	for _, req := range got {
+		paths = append(paths, req.Event+":"+req.Path)
+	}
+	want := "[create:/cd2/Movie.mkv delete:/cd2/Show move:/cd2/b.mp4]"
+	if fmt.Sprint(paths) != want {
+		t.Errorf("cloudDrive2Requests() = %v, want %s", paths, want)
+	}
+}
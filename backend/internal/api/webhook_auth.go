@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// Headers of signed webhooks: the signature is the hex HMAC-SHA256 of
+// "<timestamp>.<METHOD>.<path?query>.<body>" with the secret of the source
+const (
+	webhookSourceHeader    = "X-Webhook-Source"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookSecretRequest represents a webhook secret generate/rotate request
+type WebhookSecretRequest struct {
+	Source string `json:"source" binding:"required"` // 来源标识
+	Note   string `json:"note"`
+}
+
+// WebhookSecretResponse represents a webhook secret; the secret itself is
+// only returned when it is generated
+type WebhookSecretResponse struct {
+	ID        uint      `json:"id"`
+	Source    string    `json:"source"`
+	Secret    string    `json:"secret,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// signWebhook returns the signature of a webhook sent at timestamp. The
+// method and the request URI (path and raw query) are signed along with the
+// body, since adapters read their paths and options from the query.
+func signWebhook(secret, timestamp, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, part := range []string{timestamp, method, uri} {
+		mac.Write([]byte(part))
+		mac.Write([]byte("."))
+	}
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSourceKey is the context key of the source a signed webhook was
+// authenticated for
+const webhookSourceKey = "webhook_source"
+
+// webhookAuthMiddleware authenticates webhooks by the API token or by an
+// HMAC signature with the secret of their source. Adapter endpoints pass
+// their own name as defaultSource and are bound to it; only the generic
+// endpoint (empty defaultSource) takes the source from X-Webhook-Source or
+// the source query parameter.
+func (s *Server) webhookAuthMiddleware(defaultSource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-API-Token")
+		if token == "" {
+			token = c.GetHeader("Authorization")
+		}
+		if s.cfg.API.Token != "" && token == s.cfg.API.Token {
+			c.Next()
+			return
+		}
+
+		source := defaultSource
+		if source == "" {
+			source = c.GetHeader(webhookSourceHeader)
+		}
+		if source == "" {
+			source = c.Query("source")
+		}
+
+		if c.GetHeader(webhookSignatureHeader) == "" {
+			// Unsigned webhooks need the API token if one is set, and are
+			// refused once a secret protects the endpoint
+			if s.cfg.API.Token != "" {
+				s.rejectWebhook(c, source, "invalid or missing API token")
+				return
+			}
+			if s.signatureRequired(defaultSource) {
+				s.rejectWebhook(c, source, "missing webhook signature")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := s.verifyWebhookSignature(source, c.GetHeader(webhookTimestampHeader), c.GetHeader(webhookSignatureHeader),
+			c.Request.Method, c.Request.URL.RequestURI(), body); err != nil {
+			s.rejectWebhook(c, source, err.Error())
+			return
+		}
+		c.Set(webhookSourceKey, source)
+		c.Next()
+	}
+}
+
+// signatureRequired reports whether unsigned webhooks are refused: on an
+// adapter endpoint when its source has a secret, on the generic endpoint,
+// where the caller names the source, when any source has one
+func (s *Server) signatureRequired(defaultSource string) bool {
+	if defaultSource != "" {
+		_, err := s.db.GetWebhookSecret(defaultSource)
+		return err == nil
+	}
+	secrets, err := s.db.ListWebhookSecrets()
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to list webhook secrets: %v", err)
+		return true
+	}
+	return len(secrets) > 0
+}
+
+// verifyWebhookSignature checks the signature of a webhook request and
+// rejects stale timestamps and signatures that were already used
+func (s *Server) verifyWebhookSignature(source, timestamp, signature, method, uri string, body []byte) error {
+	if source == "" {
+		return fmt.Errorf("missing webhook source")
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid webhook timestamp")
+	}
+	tolerance := s.cfg.Webhook.SignatureTolerance * time.Second
+	now := time.Now()
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("webhook timestamp outside the allowed window")
+	}
+
+	row, err := s.db.GetWebhookSecret(source)
+	if err != nil {
+		return fmt.Errorf("no webhook secret for source %q", source)
+	}
+	secret, err := s.box.Decrypt(row.Secret)
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to decrypt webhook secret of %s: %v", source, err)
+		return fmt.Errorf("webhook secret unavailable")
+	}
+
+	signature = strings.TrimPrefix(signature, "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(signWebhook(secret, timestamp, method, uri, body))) {
+		return fmt.Errorf("invalid webhook signature")
+	}
+
+	// A signature can only be used once while its timestamp is accepted
+	s.signatureMu.Lock()
+	defer s.signatureMu.Unlock()
+	if s.usedSignatures == nil {
+		s.usedSignatures = make(map[string]time.Time)
+	}
+	for sig, expires := range s.usedSignatures {
+		if now.After(expires) {
+			delete(s.usedSignatures, sig)
+		}
+	}
+	if _, used := s.usedSignatures[signature]; used {
+		return fmt.Errorf("webhook signature already used")
+	}
+	s.usedSignatures[signature] = time.Unix(sent, 0).Add(tolerance)
+	return nil
+}
+
+// rejectWebhook aborts an unauthenticated webhook
+func (s *Server) rejectWebhook(c *gin.Context, source, reason string) {
+	log.Printf("[Webhook] Rejected webhook from %s (source=%s): %s", c.ClientIP(), source, reason)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": reason})
+	c.Abort()
+}
+
+// handleListWebhookSecrets handles listing the sources with a webhook secret
+func (s *Server) handleListWebhookSecrets(c *gin.Context) {
+	rows, err := s.db.ListWebhookSecrets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhook secrets"})
+		return
+	}
+
+	response := []WebhookSecretResponse{}
+	for _, row := range rows {
+		response = append(response, WebhookSecretResponse{
+			ID:        row.ID,
+			Source:    row.Source,
+			Note:      row.Note,
+			UpdatedAt: row.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook_secrets": response})
+}
+
+// handleGenerateWebhookSecret handles generating the secret of a source,
+// replacing its previous secret
+func (s *Server) handleGenerateWebhookSecret(c *gin.Context) {
+	var req WebhookSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate webhook secret"})
+		return
+	}
+	secret := hex.EncodeToString(key)
+
+	encrypted, err := s.box.Encrypt(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt webhook secret"})
+		return
+	}
+
+	row := &storage.WebhookSecret{
+		Source: req.Source,
+		Secret: encrypted,
+		Note:   req.Note,
+	}
+	if err := s.db.UpsertWebhookSecret(row); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save webhook secret"})
+		return
+	}
+
+	log.Printf("[API] Webhook secret generated for source %s", row.Source)
+	c.JSON(http.StatusOK, WebhookSecretResponse{
+		ID:        row.ID,
+		Source:    row.Source,
+		Secret:    secret,
+		Note:      row.Note,
+		UpdatedAt: row.UpdatedAt,
+	})
+}
+
+// handleDeleteWebhookSecret handles deleting the secret of a source
+func (s *Server) handleDeleteWebhookSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook secret id"})
+		return
+	}
+
+	if err := s.db.DeleteWebhookSecret(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook secret deleted successfully"})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/secrets"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestWebhookAuthMiddleware_Signature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	box, err := secrets.New(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("failed to create box: %v", err)
+	}
+	encrypted, _ := box.Encrypt("s3cret")
+	if err := db.UpsertWebhookSecret(&storage.WebhookSecret{Source: "qbittorrent", Secret: encrypted}); err != nil {
+		t.Fatalf("failed to save secret: %v", err)
+	}
+
+	server := &Server{
+		cfg: &config.Config{
+			API:     config.APIConfig{Token: "test-token-123"},
+			Webhook: config.WebhookConfig{SignatureTolerance: 300},
+		},
+		db:  db,
+		box: box,
+	}
+	router := gin.New()
+	router.POST("/hook/qbittorrent", server.webhookAuthMiddleware("qbittorrent"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	body := `{"path":"/downloads/movie.mkv"}`
+	uri := "/hook/qbittorrent?drive_path=/downloads"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	tests := []struct {
+		name      string
+		token     string
+		uri       string
+		timestamp string
+		signature string
+		want      int
+	}{
+		{"api token", "test-token-123", uri, "", "", http.StatusOK},
+		{"unsigned", "", uri, "", "", http.StatusUnauthorized},
+		{"signed", "", uri, now, "sha256=" + signWebhook("s3cret", now, "POST", uri, []byte(body)), http.StatusOK},
+		{"replayed", "", uri, now, "sha256=" + signWebhook("s3cret", now, "POST", uri, []byte(body)), http.StatusUnauthorized},
+		{"wrong secret", "", uri, now, signWebhook("other", now, "POST", uri, []byte(body)), http.StatusUnauthorized},
+		{"stale", "", uri, stale, signWebhook("s3cret", stale, "POST", uri, []byte(body)), http.StatusUnauthorized},
+		{"tampered query", "", "/hook/qbittorrent?drive_path=/other", now,
+			signWebhook("s3cret", now, "POST", "/hook/qbittorrent?drive_path=/downloads&x=1", []byte(body)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.uri, strings.NewReader(body))
+		if tt.token != "" {
+			req.Header.Set("X-API-Token", tt.token)
+		}
+		if tt.signature != "" {
+			req.Header.Set(webhookTimestampHeader, tt.timestamp)
+			req.Header.Set(webhookSignatureHeader, tt.signature)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status code = %v, want %v", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestWebhookAuthMiddleware_SourceBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	box, err := secrets.New(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("failed to create box: %v", err)
+	}
+
+	// No API token: secrets are the only protection
+	server := &Server{
+		cfg: &config.Config{Webhook: config.WebhookConfig{SignatureTolerance: 300}},
+		db:  db,
+		box: box,
+	}
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "success"}) }
+	router := gin.New()
+	router.POST("/hook", server.webhookAuthMiddleware(""), server.handleWebhook)
+	router.POST("/hook/open", server.webhookAuthMiddleware(""), ok)
+	router.POST("/hook/qbittorrent", server.webhookAuthMiddleware("qbittorrent"), ok)
+
+	send := func(uri, source, body string, signed bool) int {
+		req := httptest.NewRequest("POST", uri, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if source != "" {
+			req.Header.Set(webhookSourceHeader, source)
+		}
+		if signed {
+			now := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(webhookTimestampHeader, now)
+			req.Header.Set(webhookSignatureHeader, signWebhook("s3cret", now, "POST", uri, []byte(body)))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without any secret unsigned webhooks are accepted
+	if got := send("/hook/open", "", "{}", false); got != http.StatusOK {
+		t.Errorf("unsigned webhook without secrets: status code = %d, want %d", got, http.StatusOK)
+	}
+
+	encrypted, _ := box.Encrypt("s3cret")
+	if err := db.UpsertWebhookSecret(&storage.WebhookSecret{Source: "qbittorrent", Secret: encrypted}); err != nil {
+		t.Fatalf("failed to save secret: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		uri    string
+		source string
+		body   string
+		signed bool
+		want   int
+	}{
+		// Naming a source without a secret must not skip the signature
+		{"adapter with other source", "/hook/qbittorrent", "sonarr", "{}", false, http.StatusUnauthorized},
+		{"adapter with other query source", "/hook/qbittorrent?source=sonarr", "", "{}", false, http.StatusUnauthorized},
+		{"generic with other source", "/hook/open", "sonarr", "{}", false, http.StatusUnauthorized},
+		{"generic unsigned", "/hook/open", "", "{}", false, http.StatusUnauthorized},
+		{"adapter signed", "/hook/qbittorrent", "sonarr", "{}", true, http.StatusOK},
+		// The body cannot claim another source than the signed one
+		{"generic body source mismatch", "/hook", "qbittorrent", `{"path":"/a.mkv","source":"sonarr"}`, true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := send(tt.uri, tt.source, tt.body, tt.signed); got != tt.want {
+			t.Errorf("%s: status code = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+const (
+	// inboxPollInterval is how often the inbox retries due events and
+	// checks the tasks of queued events
+	inboxPollInterval = 5 * time.Second
+	// maxRetryDelay caps the doubling delay between retries
+	maxRetryDelay = time.Hour
+	// inboxClaimTimeout is when the inbox takes over a stored event whose
+	// request handler did not record an outcome, e.g. after a crash
+	inboxClaimTimeout = time.Minute
+	// inboxPruneInterval is how often finished events older than the
+	// retention are deleted
+	inboxPruneInterval = time.Hour
+)
+
+// WebhookEventResponse represents a stored webhook event
+type WebhookEventResponse struct {
+	ID            uint           `json:"id"`
+	Path          string         `json:"path"`
+	Event         string         `json:"event,omitempty"`
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty"`
+	TaskID        string         `json:"task_id,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	Request       WebhookRequest `json:"request"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// handleWebhook handles webhook notifications from external systems. The
+// event is stored before it is processed, so it can be retried when its
+// task fails or the process restarts.
+func (s *Server) handleWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, WebhookResponse{
+			Success: false,
+			Message: "invalid request body",
+		})
+		return
+	}
+	// The source picks the path rules, so a signed webhook keeps the one it
+	// was authenticated for
+	if source := c.GetString(webhookSourceKey); source != "" {
+		if req.Source != "" && req.Source != source {
+			c.JSON(http.StatusForbidden, WebhookResponse{
+				Success: false,
+				Message: fmt.Sprintf("source %q does not match the signed source %q", req.Source, source),
+			})
+			return
+		}
+		req.Source = source
+	}
+	c.JSON(s.acceptWebhook(req))
+}
+
+// acceptWebhook stores a webhook event and processes it, returning the HTTP
+// status and response of the webhook
+func (s *Server) acceptWebhook(req WebhookRequest) (int, WebhookResponse) {
+	payload, _ := json.Marshal(req)
+	event := &storage.WebhookEvent{
+		Payload:       string(payload),
+		Path:          req.Path,
+		Event:         req.Event,
+		Status:        storage.WebhookEventProcessing,
+		NextAttemptAt: time.Now().Add(inboxClaimTimeout),
+	}
+	if err := s.db.CreateWebhookEvent(event); err != nil {
+		// Still handle the webhook, it just cannot be retried
+		log.Printf("[Webhook] WARNING: Failed to store webhook event: %v", err)
+		return s.processWebhook(req)
+	}
+
+	status, resp := s.processWebhookEvent(event, req)
+	resp.EventID = event.ID
+	if status >= http.StatusInternalServerError && event.Status == storage.WebhookEventPending {
+		status = http.StatusAccepted
+		resp.Success = true
+		resp.Message = fmt.Sprintf("webhook stored, processing will be retried: %s", resp.Message)
+	}
+	return status, resp
+}
+
+// processWebhookEvent processes a stored webhook event and records the
+// outcome: server errors are retried later, client errors are final
+func (s *Server) processWebhookEvent(event *storage.WebhookEvent, req WebhookRequest) (int, WebhookResponse) {
+	event.Attempts++
+	status, resp := s.processWebhook(req)
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		s.retryWebhookEvent(event, resp.Message)
+	case status >= http.StatusBadRequest:
+		event.Status = storage.WebhookEventFailed
+		event.LastError = resp.Message
+	case resp.Skipped:
+		event.Status = storage.WebhookEventSkipped
+		event.LastError = ""
+	default:
+		event.Status = storage.WebhookEventQueued
+		event.TaskID = resp.TaskID
+		event.LastError = ""
+	}
+	if err := s.db.UpdateWebhookEvent(event); err != nil {
+		log.Printf("[Webhook] WARNING: Failed to update webhook event %d: %v", event.ID, err)
+	}
+	return status, resp
+}
+
+// retryWebhookEvent schedules another attempt of event, or marks it failed
+// once its retries are exhausted
+func (s *Server) retryWebhookEvent(event *storage.WebhookEvent, reason string) {
+	event.LastError = reason
+	maxRetries := s.cfg.Webhook.MaxRetries
+	if event.Attempts > maxRetries {
+		event.Status = storage.WebhookEventFailed
+		log.Printf("[Webhook] Event %d FAILED after %d attempts: %s", event.ID, event.Attempts, reason)
+		return
+	}
+
+	delay := s.cfg.Webhook.RetryInterval * time.Second
+	for i := 1; i < event.Attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	event.Status = storage.WebhookEventPending
+	event.NextAttemptAt = time.Now().Add(delay)
+	log.Printf("[Webhook] Event %d will be retried in %v (attempt %d/%d): %s", event.ID, delay, event.Attempts, maxRetries+1, reason)
+}
+
+// startWebhookInbox processes stored webhook events in the background until
+// the server shuts down: pending events left by a restart or waiting for a
+// retry are processed, and queued events follow the outcome of their task
+func (s *Server) startWebhookInbox() {
+	s.inboxWG.Add(1)
+	go func() {
+		defer s.inboxWG.Done()
+		ticker := time.NewTicker(inboxPollInterval)
+		defer ticker.Stop()
+		var lastPrune time.Time
+		for {
+			if time.Since(lastPrune) >= inboxPruneInterval {
+				s.pruneWebhookEvents()
+				lastPrune = time.Now()
+			}
+			s.settleWebhookEvents()
+			s.processDueWebhookEvents()
+			select {
+			case <-s.inboxStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processDueWebhookEvents processes the pending events due now
+func (s *Server) processDueWebhookEvents() {
+	events, err := s.db.ListDueWebhookEvents(time.Now())
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to list pending webhook events: %v", err)
+		return
+	}
+	for _, event := range events {
+		var req WebhookRequest
+		if err := json.Unmarshal([]byte(event.Payload), &req); err != nil {
+			event.Status = storage.WebhookEventFailed
+			event.LastError = fmt.Sprintf("invalid stored payload: %v", err)
+			if err := s.db.UpdateWebhookEvent(event); err != nil {
+				log.Printf("[Webhook] WARNING: Failed to update webhook event %d: %v", event.ID, err)
+			}
+			continue
+		}
+		if !s.claimWebhookEvent(event) {
+			continue
+		}
+		log.Printf("[Webhook] Processing stored event %d (attempt %d): path=%s", event.ID, event.Attempts+1, event.Path)
+		s.processWebhookEvent(event, req)
+	}
+}
+
+// claimWebhookEvent claims a stored event for processing, reporting false
+// when a replay or the inbox claimed it first
+func (s *Server) claimWebhookEvent(event *storage.WebhookEvent) bool {
+	now := time.Now()
+	claimed, err := s.db.ClaimWebhookEvent(event, now, now.Add(inboxClaimTimeout))
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to claim webhook event %d: %v", event.ID, err)
+		return false
+	}
+	if !claimed {
+		log.Printf("[Webhook] Event %d is already being processed, skipping", event.ID)
+	}
+	return claimed
+}
+
+// settleWebhookEvents updates queued events from the status of their task:
+// finished tasks complete the event, failed or interrupted tasks retry it.
+// Interrupted tasks are left to the scheduler when it resumes them on start.
+// Events merged into one batch task by the debounce are settled together,
+// so a failed batch is retried once: its events become due at the same
+// time and are merged into one task again.
+func (s *Server) settleWebhookEvents() {
+	events, err := s.db.ListWebhookEvents(storage.WebhookEventQueued, -1, 0)
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to list queued webhook events: %v", err)
+		return
+	}
+
+	var taskIDs []string
+	byTask := make(map[string][]*storage.WebhookEvent)
+	for _, event := range events {
+		if _, ok := byTask[event.TaskID]; !ok {
+			taskIDs = append(taskIDs, event.TaskID)
+		}
+		byTask[event.TaskID] = append(byTask[event.TaskID], event)
+	}
+
+	for _, taskID := range taskIDs {
+		group := byTask[taskID]
+		// The retry decision is taken once, for the event with the most
+		// attempts, and shared by the whole group
+		lead := group[0]
+		for _, event := range group[1:] {
+			if event.Attempts > lead.Attempts {
+				lead = event
+			}
+		}
+
+		task, err := s.db.GetTaskByID(taskID)
+		if err != nil {
+			s.retryWebhookEvent(lead, "task not found")
+		} else {
+			switch task.Status {
+			case storage.TaskStatusQueued, storage.TaskStatusRunning:
+				continue
+			case storage.TaskStatusCompleted, storage.TaskStatusSkipped:
+				lead.Status = storage.WebhookEventProcessed
+			case storage.TaskStatusCancelled:
+				lead.Status = storage.WebhookEventFailed
+				lead.LastError = "task cancelled: " + task.Errors
+			case storage.TaskStatusInterrupted:
+				if s.cfg.Scheduler.RequeueInterrupted {
+					// The scheduler resumes the task under the same ID
+					continue
+				}
+				s.retryWebhookEvent(lead, fmt.Sprintf("task %s: %s", task.Status, task.Errors))
+			default:
+				s.retryWebhookEvent(lead, fmt.Sprintf("task %s: %s", task.Status, task.Errors))
+			}
+		}
+
+		for _, event := range group {
+			event.Status = lead.Status
+			event.LastError = lead.LastError
+			event.NextAttemptAt = lead.NextAttemptAt
+			if err := s.db.UpdateWebhookEvent(event); err != nil {
+				log.Printf("[Webhook] WARNING: Failed to update webhook event %d: %v", event.ID, err)
+			}
+		}
+	}
+}
+
+// pruneWebhookEvents deletes finished events older than the event retention
+func (s *Server) pruneWebhookEvents() {
+	before := time.Now().Add(-s.cfg.Webhook.EventRetention * time.Hour)
+	n, err := s.db.PruneWebhookEvents(before)
+	if err != nil {
+		log.Printf("[Webhook] WARNING: Failed to prune webhook events: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[Webhook] Pruned %d webhook events finished before %s", n, before.Format(time.RFC3339))
+	}
+}
+
+// handleListWebhookEvents handles listing stored webhook events, newest
+// first, with limit/offset paging
+func (s *Server) handleListWebhookEvents(c *gin.Context) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	status := c.Query("status")
+	events, err := s.db.ListWebhookEvents(status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhook events"})
+		return
+	}
+
+	// Get total count
+	total, err := s.db.CountWebhookEvents(status)
+	if err != nil {
+		total = 0
+	}
+
+	response := []WebhookEventResponse{}
+	for _, event := range events {
+		response = append(response, webhookEventResponse(event))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events": response,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// handleReplayWebhookEvent handles processing a stored webhook event again
+func (s *Server) handleReplayWebhookEvent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id"})
+		return
+	}
+	event, err := s.db.GetWebhookEvent(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook event not found"})
+		return
+	}
+	if event.Status == storage.WebhookEventQueued {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "event task is still queued or running",
+			"task_id": event.TaskID,
+		})
+		return
+	}
+
+	var req WebhookRequest
+	if err := json.Unmarshal([]byte(event.Payload), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid stored payload"})
+		return
+	}
+	if !s.claimWebhookEvent(event) {
+		c.JSON(http.StatusConflict, gin.H{"error": "event is already being processed"})
+		return
+	}
+
+	// A replay starts a fresh series of retries
+	log.Printf("[Webhook] Replaying event %d: path=%s", event.ID, event.Path)
+	event.Attempts = 0
+	status, resp := s.processWebhookEvent(event, req)
+	resp.EventID = event.ID
+	c.JSON(status, resp)
+}
+
+// webhookEventResponse converts a stored webhook event
+func webhookEventResponse(event *storage.WebhookEvent) WebhookEventResponse {
+	resp := WebhookEventResponse{
+		ID:        event.ID,
+		Path:      event.Path,
+		Event:     event.Event,
+		Status:    event.Status,
+		Attempts:  event.Attempts,
+		TaskID:    event.TaskID,
+		LastError: event.LastError,
+		CreatedAt: event.CreatedAt,
+		UpdatedAt: event.UpdatedAt,
+	}
+	if event.Status == storage.WebhookEventPending {
+		next := event.NextAttemptAt
+		resp.NextAttemptAt = &next
+	}
+	_ = json.Unmarshal([]byte(event.Payload), &resp.Request)
+	return resp
+}
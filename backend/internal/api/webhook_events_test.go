@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestSettleWebhookEvents(t *testing.T) {
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	server := &Server{cfg: &config.Config{Webhook: config.WebhookConfig{MaxRetries: 2, RetryInterval: 30}}, db: db}
+
+	tasks := map[string]string{
+		"done":      storage.TaskStatusCompleted,
+		"running":   storage.TaskStatusRunning,
+		"failed":    storage.TaskStatusFailed,
+		"exhausted": storage.TaskStatusFailed,
+		"cancelled": storage.TaskStatusCancelled,
+	}
+	events := map[string]*storage.WebhookEvent{}
+	for taskID, status := range tasks {
+		if err := db.CreateTask(&storage.Task{TaskID: taskID, Status: status, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		event := &storage.WebhookEvent{Payload: "{}", Status: storage.WebhookEventQueued, TaskID: taskID, Attempts: 1}
+		if taskID == "exhausted" {
+			event.Attempts = 3
+		}
+		if err := db.CreateWebhookEvent(event); err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+		events[taskID] = event
+	}
+
+	before := time.Now()
+	server.settleWebhookEvents()
+
+	want := map[string]string{
+		"done":      storage.WebhookEventProcessed,
+		"running":   storage.WebhookEventQueued,
+		"failed":    storage.WebhookEventPending,
+		"exhausted": storage.WebhookEventFailed,
+		"cancelled": storage.WebhookEventFailed,
+	}
+	for taskID, status := range want {
+		got, err := db.GetWebhookEvent(events[taskID].ID)
+		if err != nil {
+			t.Fatalf("failed to get event: %v", err)
+		}
+		if got.Status != status {
+			t.Errorf("event of %s task: status = %s, want %s", taskID, got.Status, status)
+		}
+		if taskID == "failed" && got.NextAttemptAt.Before(before.Add(30*time.Second)) {
+			t.Errorf("retry scheduled at %v, want at least 30s later", got.NextAttemptAt)
+		}
+	}
+
+	// Only due events are picked up by the inbox
+	if due, _ := db.ListDueWebhookEvents(time.Now()); len(due) != 0 {
+		t.Errorf("expected no due events, got %d", len(due))
+	}
+}
+
+func TestSettleWebhookEvents_BatchTask(t *testing.T) {
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	server := &Server{cfg: &config.Config{Webhook: config.WebhookConfig{MaxRetries: 2, RetryInterval: 30}}, db: db}
+
+	if err := db.CreateTask(&storage.Task{TaskID: "batch", Status: storage.TaskStatusFailed, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	// One event of the batch already used its retries: the batch is not retried again
+	var ids []uint
+	for _, attempts := range []int{1, 3, 1} {
+		event := &storage.WebhookEvent{Payload: "{}", Status: storage.WebhookEventQueued, TaskID: "batch", Attempts: attempts}
+		if err := db.CreateWebhookEvent(event); err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	server.settleWebhookEvents()
+
+	for _, id := range ids {
+		got, err := db.GetWebhookEvent(id)
+		if err != nil {
+			t.Fatalf("failed to get event: %v", err)
+		}
+		if got.Status != storage.WebhookEventFailed {
+			t.Errorf("event %d: status = %s, want %s", id, got.Status, storage.WebhookEventFailed)
+		}
+	}
+}
+
+func TestPruneWebhookEvents(t *testing.T) {
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	server := &Server{cfg: &config.Config{Webhook: config.WebhookConfig{EventRetention: 24}}, db: db}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, event := range []*storage.WebhookEvent{
+		{Path: "old-processed", Status: storage.WebhookEventProcessed, UpdatedAt: old},
+		{Path: "old-failed", Status: storage.WebhookEventFailed, UpdatedAt: old},
+		{Path: "old-pending", Status: storage.WebhookEventPending, UpdatedAt: old},
+		{Path: "new-processed", Status: storage.WebhookEventProcessed},
+	} {
+		event.Payload = "{}"
+		if err := db.CreateWebhookEvent(event); err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	server.pruneWebhookEvents()
+
+	events, err := db.ListWebhookEvents("", -1, 0)
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	var paths []string
+	for _, event := range events {
+		paths = append(paths, event.Path)
+	}
+	if want := "[new-processed old-pending]"; fmt.Sprint(paths) != want {
+		t.Errorf("remaining events = %v, want %s", paths, want)
+	}
+}
+
+func TestClaimWebhookEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	server := &Server{cfg: &config.Config{}, db: db}
+
+	event := &storage.WebhookEvent{Payload: "{}", Status: storage.WebhookEventPending, NextAttemptAt: time.Now()}
+	if err := db.CreateWebhookEvent(event); err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	// The inbox and a replay both read the event as pending
+	inbox, _ := db.GetWebhookEvent(event.ID)
+	replay, _ := db.GetWebhookEvent(event.ID)
+
+	if !server.claimWebhookEvent(inbox) {
+		t.Fatal("expected the first claim to succeed")
+	}
+	if server.claimWebhookEvent(replay) {
+		t.Error("expected a second claim of the same event to fail")
+	}
+
+	// A replay of an event being processed is refused
+	router := gin.New()
+	router.POST("/events/:id/replay", server.handleReplayWebhookEvent)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/events/%d/replay", event.ID), nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("replay status code = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// Once the claim expired the inbox takes the event over
+	if due, _ := db.ListDueWebhookEvents(time.Now().Add(2 * inboxClaimTimeout)); len(due) != 1 {
+		t.Fatalf("expected the expired claim to be due, got %d events", len(due))
+	}
+	stale, _ := db.GetWebhookEvent(event.ID)
+	if claimed, err := db.ClaimWebhookEvent(stale, time.Now().Add(2*inboxClaimTimeout), time.Now().Add(3*inboxClaimTimeout)); err != nil || !claimed {
+		t.Errorf("claim of an expired claim = %v, %v; want claimed", claimed, err)
+	}
+}
+
+func TestSettleWebhookEvents_InterruptedTask(t *testing.T) {
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	cfg := &config.Config{Webhook: config.WebhookConfig{MaxRetries: 2, RetryInterval: 30}}
+	server := &Server{cfg: cfg, db: db}
+
+	if err := db.CreateTask(&storage.Task{TaskID: "interrupted", Status: storage.TaskStatusInterrupted, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	event := &storage.WebhookEvent{Payload: "{}", Status: storage.WebhookEventQueued, TaskID: "interrupted", Attempts: 1}
+	if err := db.CreateWebhookEvent(event); err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+
+	for _, tt := range []struct {
+		requeue bool
+		want    string
+	}{
+		// The scheduler resumes the task: the event waits for it
+		{true, storage.WebhookEventQueued},
+		{false, storage.WebhookEventPending},
+	} {
+		cfg.Scheduler.RequeueInterrupted = tt.requeue
+		server.settleWebhookEvents()
+		if got, _ := db.GetWebhookEvent(event.ID); got.Status != tt.want {
+			t.Errorf("requeue_interrupted=%v: status = %s, want %s", tt.requeue, got.Status, tt.want)
+		}
+	}
+}
+
+func TestListWebhookEvents_Offset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	server := &Server{cfg: &config.Config{}, db: db}
+	for i := 1; i <= 5; i++ {
+		if err := db.CreateWebhookEvent(&storage.WebhookEvent{Payload: "{}", Path: fmt.Sprint(i), Status: storage.WebhookEventProcessed}); err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/events", server.handleListWebhookEvents)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/events?limit=2&offset=2", nil))
+
+	var resp struct {
+		Events []WebhookEventResponse `json:"events"`
+		Total  int64                  `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	var paths []string
+	for _, event := range resp.Events {
+		paths = append(paths, event.Path)
+	}
+	if got := fmt.Sprint(paths); got != "[3 2]" || resp.Total != 5 {
+		t.Errorf("page = %s of %d, want [3 2] of 5", got, resp.Total)
+	}
+}
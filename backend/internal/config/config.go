@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"time"
 )
 
@@ -14,6 +15,9 @@ type Config struct {
 	Log         LogConfig         `mapstructure:"log"`
 	Database    DatabaseConfig    `mapstructure:"database"`
 	MediaServer MediaServerConfig `mapstructure:"media_server"`
+	Security    SecurityConfig    `mapstructure:"security"`
+	Scheduler   SchedulerConfig   `mapstructure:"scheduler"`
+	Webhook     WebhookConfig     `mapstructure:"webhook"`
 }
 
 // ServerConfig represents server configuration
@@ -24,14 +28,23 @@ type ServerConfig struct {
 
 // AlistConfig represents Alist server configuration
 type AlistConfig struct {
-	URL         string        `mapstructure:"url"`
-	Token       string        `mapstructure:"token"`
-	SignEnabled bool          `mapstructure:"sign_enabled"`
-	Timeout     time.Duration `mapstructure:"timeout"`
+	URL             string        `mapstructure:"url"`
+	Token           string        `mapstructure:"token"`
+	SignEnabled     bool          `mapstructure:"sign_enabled"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	ListConcurrency int           `mapstructure:"list_concurrency"` // 递归列目录时的并发数
+	ListRateLimit   float64       `mapstructure:"list_rate_limit"`  // 递归列目录时每秒最多请求数，0 表示不限制
+
+	// 账号密码登录（可替代 token，过期后自动续期）
+	Username     string `mapstructure:"username"`
+	Password     string `mapstructure:"password"`
+	HashPassword bool   `mapstructure:"hash_password"` // 使用 /api/auth/login/hash 登录
+	OTPSecret    string `mapstructure:"otp_secret"`    // 两步验证密钥（base32）
 }
 
 // MappingConfig represents path mapping configuration (internal use, not from YAML)
 type MappingConfig struct {
+	ID         uint
 	Name       string
 	Source     string
 	Target     string
@@ -41,6 +54,18 @@ type MappingConfig struct {
 	STRMMode   string
 	Enabled    bool
 	CronExpr   string
+
+	ListingCache     bool          // reuse listings of unchanged directories in incremental mode
+	DeepScanInterval time.Duration // how often a cached mapping is fully rescanned
+	LastDeepScanAt   *time.Time
+
+	Discovery   string        // list or search
+	IndexMaxAge time.Duration // maximum search index age, 0 disables the check
+
+	RefreshPolicy string // never, top, subpath or always
+	RefreshPath   string // refreshed subpath for the subpath policy
+
+	ConflictPolicy string // skip, queue or cancel when triggered while running
 }
 
 // APIConfig represents API configuration
@@ -70,6 +95,40 @@ type DatabaseConfig struct {
 	Path string `mapstructure:"path"`
 }
 
+// SchedulerConfig represents task queue configuration
+type SchedulerConfig struct {
+	Workers int `mapstructure:"workers"` // mappings generated at the same time
+
+	// 退出时等待运行中任务的时长（秒），超时后取消任务
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// 启动时从中断处恢复上次退出时被中断的任务
+	RequeueInterrupted bool `mapstructure:"requeue_interrupted"`
+	// 失败、取消或中断的任务的断点保留时长（小时），超过后无法从断点恢复
+	CheckpointRetention time.Duration `mapstructure:"checkpoint_retention"`
+}
+
+// WebhookConfig represents webhook handling configuration
+type WebhookConfig struct {
+	// 合并窗口（秒）：同一映射在窗口内收到的 Webhook 合并为一次任务，0 表示不合并
+	DebounceWindow time.Duration `mapstructure:"debounce_window"`
+	// 处理失败（如 Alist 不可用导致任务失败）后的最大重试次数，0 表示不重试
+	MaxRetries int `mapstructure:"max_retries"`
+	// 首次重试前的等待时间（秒），之后每次翻倍
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	// 签名时间戳允许的最大偏差（秒），超出视为重放
+	SignatureTolerance time.Duration `mapstructure:"signature_tolerance"`
+	// 已完成、已跳过或失败的 Webhook 事件的保留时长（小时），超过后删除
+	EventRetention time.Duration `mapstructure:"event_retention"`
+}
+
+// SecurityConfig represents configuration for secrets stored in the database
+type SecurityConfig struct {
+	// SecretKey encrypts stored secrets; when empty a random key is generated
+	// in KeyFile (default: secret.key next to the database)
+	SecretKey string `mapstructure:"secret_key"`
+	KeyFile   string `mapstructure:"key_file"`
+}
+
 // MediaServerConfig represents media server notification configuration
 type MediaServerConfig struct {
 	Enabled  bool                `mapstructure:"enabled"`
@@ -96,14 +155,41 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("alist url is required")
 	}
 
-	if c.Alist.Token == "" {
-		return fmt.Errorf("alist token is required")
+	if c.Alist.Token == "" && (c.Alist.Username == "" || c.Alist.Password == "") {
+		return fmt.Errorf("alist token or username/password is required")
 	}
 
 	if c.Database.Path == "" {
 		c.Database.Path = "./data/openlist-strm.db"
 	}
 
+	if c.Scheduler.Workers <= 0 {
+		c.Scheduler.Workers = 2
+	}
+	if c.Scheduler.ShutdownTimeout <= 0 {
+		c.Scheduler.ShutdownTimeout = 30
+	}
+	if c.Scheduler.CheckpointRetention <= 0 {
+		c.Scheduler.CheckpointRetention = 168
+	}
+
+	if c.Webhook.MaxRetries < 0 {
+		c.Webhook.MaxRetries = 5
+	}
+	if c.Webhook.RetryInterval <= 0 {
+		c.Webhook.RetryInterval = 30
+	}
+	if c.Webhook.SignatureTolerance <= 0 {
+		c.Webhook.SignatureTolerance = 300
+	}
+	if c.Webhook.EventRetention <= 0 {
+		c.Webhook.EventRetention = 168
+	}
+
+	if c.Security.KeyFile == "" {
+		c.Security.KeyFile = filepath.Join(filepath.Dir(c.Database.Path), "secret.key")
+	}
+
 	return nil
 }
 
@@ -24,6 +24,10 @@ func Load(configPath string) (*Config, error) {
 		v.AddConfigPath("/etc/openlist-strm") // 系统目录
 	}
 
+	// Settings where 0 is a valid value need their default here: Validate
+	// can't tell an explicit 0 from a missing key
+	v.SetDefault("webhook.max_retries", DefaultConfig().Webhook.MaxRetries)
+
 	// Read config file
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -64,10 +68,11 @@ func DefaultConfig() *Config {
 			Port: 8080,
 		},
 		Alist: AlistConfig{
-			URL:         "http://localhost:5244",
-			Token:       "",
-			SignEnabled: false,
-			Timeout:     30,
+			URL:             "http://localhost:5244",
+			Token:           "",
+			SignEnabled:     false,
+			Timeout:         30,
+			ListConcurrency: 4,
 		},
 		API: APIConfig{
 			Enabled: true,
@@ -88,5 +93,16 @@ func DefaultConfig() *Config {
 		Database: DatabaseConfig{
 			Path: "./data/openlist-strm.db",
 		},
+		Scheduler: SchedulerConfig{
+			Workers:             2,
+			ShutdownTimeout:     30,
+			CheckpointRetention: 168,
+		},
+		Webhook: WebhookConfig{
+			MaxRetries:         5,
+			RetryInterval:      30,
+			SignatureTolerance: 300,
+			EventRetention:     168,
+		},
 	}
 }
@@ -14,9 +14,23 @@ import (
 	"github.com/konghanghang/openlist-strm/internal/config"
 )
 
+// 媒体库变更类型（Emby/Jellyfin 的 UpdateType）
+const (
+	UpdateCreated  = "Created"
+	UpdateModified = "Modified"
+	UpdateDeleted  = "Deleted"
+)
+
+// Update 一条媒体库路径变更
+type Update struct {
+	Path       string
+	UpdateType string
+}
+
 // Notifier 媒体服务器通知接口
 type Notifier interface {
 	NotifyLibraryScan(ctx context.Context, strmPath string) error
+	NotifyUpdates(ctx context.Context, updates []Update) error
 }
 
 // MediaServerNotifier 媒体服务器通知服务
@@ -37,6 +51,11 @@ func NewMediaServerNotifier(cfg *config.MediaServerConfig) *MediaServerNotifier
 
 // NotifyLibraryScan 通知媒体服务器扫描库
 func (n *MediaServerNotifier) NotifyLibraryScan(ctx context.Context, strmPath string) error {
+	return n.NotifyUpdates(ctx, []Update{{Path: strmPath, UpdateType: UpdateCreated}})
+}
+
+// NotifyUpdates 通知媒体服务器路径变更（新增、修改、删除）
+func (n *MediaServerNotifier) NotifyUpdates(ctx context.Context, updates []Update) error {
 	if !n.config.Enabled {
 		log.Printf("[MediaServer] Notification disabled, skipping")
 		return nil
@@ -47,18 +66,18 @@ func (n *MediaServerNotifier) NotifyLibraryScan(ctx context.Context, strmPath st
 	// 根据配置的类型通知对应的服务器
 	switch n.config.Type {
 	case "emby":
-		if err := n.notifyEmby(ctx, strmPath); err != nil {
+		if err := n.notifyEmby(ctx, updates); err != nil {
 			errs = append(errs, fmt.Errorf("emby notification failed: %w", err))
 		}
 	case "jellyfin":
-		if err := n.notifyJellyfin(ctx, strmPath); err != nil {
+		if err := n.notifyJellyfin(ctx, updates); err != nil {
 			errs = append(errs, fmt.Errorf("jellyfin notification failed: %w", err))
 		}
 	case "both":
-		if err := n.notifyEmby(ctx, strmPath); err != nil {
+		if err := n.notifyEmby(ctx, updates); err != nil {
 			errs = append(errs, fmt.Errorf("emby notification failed: %w", err))
 		}
-		if err := n.notifyJellyfin(ctx, strmPath); err != nil {
+		if err := n.notifyJellyfin(ctx, updates); err != nil {
 			errs = append(errs, fmt.Errorf("jellyfin notification failed: %w", err))
 		}
 	default:
@@ -77,7 +96,7 @@ func (n *MediaServerNotifier) NotifyLibraryScan(ctx context.Context, strmPath st
 }
 
 // notifyEmby 通知 Emby 扫描
-func (n *MediaServerNotifier) notifyEmby(ctx context.Context, strmPath string) error {
+func (n *MediaServerNotifier) notifyEmby(ctx context.Context, updates []Update) error {
 	if n.config.Emby.URL == "" || n.config.Emby.APIKey == "" {
 		log.Printf("[Emby] Skipping: URL or API Key not configured")
 		return nil
@@ -88,25 +107,23 @@ func (n *MediaServerNotifier) notifyEmby(ctx context.Context, strmPath string) e
 
 	if n.config.Emby.ScanMode == "path" && len(n.config.Emby.PathMapping) > 0 {
 		// 路径映射模式：扫描特定路径
-		mappedPath := n.mapPath(strmPath, n.config.Emby.PathMapping)
 		url = fmt.Sprintf("%s/Library/Media/Updated?api_key=%s", n.config.Emby.URL, n.config.Emby.APIKey)
 
 		// 构建请求体
-		updates := map[string]interface{}{
-			"Updates": []map[string]string{
-				{
-					"Path":       mappedPath,
-					"UpdateType": "Created",
-				},
-			},
+		var items []map[string]string
+		for _, u := range updates {
+			mappedPath := n.mapPath(u.Path, n.config.Emby.PathMapping)
+			items = append(items, map[string]string{
+				"Path":       mappedPath,
+				"UpdateType": u.UpdateType,
+			})
+			log.Printf("[Emby] Notifying path scan: %s -> %s (%s)", u.Path, mappedPath, u.UpdateType)
 		}
 		var err error
-		requestBody, err = json.Marshal(updates)
+		requestBody, err = json.Marshal(map[string]interface{}{"Updates": items})
 		if err != nil {
 			return fmt.Errorf("failed to marshal request body: %w", err)
 		}
-
-		log.Printf("[Emby] Notifying path scan: %s -> %s", strmPath, mappedPath)
 	} else {
 		// 全局扫描模式
 		url = fmt.Sprintf("%s/Library/Refresh?api_key=%s", n.config.Emby.URL, n.config.Emby.APIKey)
@@ -142,7 +159,7 @@ func (n *MediaServerNotifier) notifyEmby(ctx context.Context, strmPath string) e
 }
 
 // notifyJellyfin 通知 Jellyfin 扫描
-func (n *MediaServerNotifier) notifyJellyfin(ctx context.Context, strmPath string) error {
+func (n *MediaServerNotifier) notifyJellyfin(ctx context.Context, updates []Update) error {
 	if n.config.Jellyfin.URL == "" || n.config.Jellyfin.APIKey == "" {
 		log.Printf("[Jellyfin] Skipping: URL or API Key not configured")
 		return nil
@@ -153,25 +170,23 @@ func (n *MediaServerNotifier) notifyJellyfin(ctx context.Context, strmPath strin
 
 	if n.config.Jellyfin.ScanMode == "path" && len(n.config.Jellyfin.PathMapping) > 0 {
 		// 路径映射模式：扫描特定路径
-		mappedPath := n.mapPath(strmPath, n.config.Jellyfin.PathMapping)
 		url = fmt.Sprintf("%s/Library/Media/Updated?api_key=%s", n.config.Jellyfin.URL, n.config.Jellyfin.APIKey)
 
 		// 构建请求体
-		updates := map[string]interface{}{
-			"Updates": []map[string]string{
-				{
-					"Path":       mappedPath,
-					"UpdateType": "Created",
-				},
-			},
+		var items []map[string]string
+		for _, u := range updates {
+			mappedPath := n.mapPath(u.Path, n.config.Jellyfin.PathMapping)
+			items = append(items, map[string]string{
+				"Path":       mappedPath,
+				"UpdateType": u.UpdateType,
+			})
+			log.Printf("[Jellyfin] Notifying path scan: %s -> %s (%s)", u.Path, mappedPath, u.UpdateType)
 		}
 		var err error
-		requestBody, err = json.Marshal(updates)
+		requestBody, err = json.Marshal(map[string]interface{}{"Updates": items})
 		if err != nil {
 			return fmt.Errorf("failed to marshal request body: %w", err)
 		}
-
-		log.Printf("[Jellyfin] Notifying path scan: %s -> %s", strmPath, mappedPath)
 	} else {
 		// 全局扫描模式
 		url = fmt.Sprintf("%s/Library/Refresh?api_key=%s", n.config.Jellyfin.URL, n.config.Jellyfin.APIKey)
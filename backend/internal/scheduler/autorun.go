@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// runOnStartup queues one run of each enabled mapping that asks to run at
+// process startup
+func (s *Scheduler) runOnStartup(mappings []*storage.Mapping) {
+	for _, mapping := range mappings {
+		if !mapping.Enabled || !mapping.RunOnStartup {
+			continue
+		}
+		if taskID, err := s.Enqueue(context.Background(), mapping.Name, TriggerStartup, RunOptions{}); err != nil {
+			log.Printf("[Scheduler] Startup task FAILED to queue for mapping %s: %v", mapping.Name, err)
+		} else {
+			log.Printf("[Scheduler] Startup task QUEUED for mapping %s: task=%s", mapping.Name, taskID)
+		}
+	}
+}
+
+// RunAfterChange queues a run of a mapping that was created or whose source,
+// target or rules were edited. A changed target is filled by a full run.
+func (s *Scheduler) RunAfterChange(mapping *storage.Mapping, targetChanged bool) (string, error) {
+	var opts RunOptions
+	if targetChanged {
+		opts.Mode = "full"
+	}
+	taskID, err := s.Enqueue(context.Background(), mapping.Name, TriggerChange, opts)
+	if err != nil {
+		log.Printf("[Scheduler] Change task FAILED to queue for mapping %s: %v", mapping.Name, err)
+		return "", err
+	}
+	log.Printf("[Scheduler] Change task QUEUED for mapping %s: task=%s, mode=%s", mapping.Name, taskID, opts.Mode)
+	return taskID, nil
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestStartupRuns(t *testing.T) {
+	s := newTestScheduler(t)
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	mappings := []*storage.Mapping{
+		{Name: "startup", Enabled: true, RunOnStartup: true, CronExpr: "0 0 3 * * *", LastScheduledAt: &lastWeek},
+		{Name: "missed", Enabled: true, CronExpr: "0 0 3 * * *", CatchUpPolicy: CatchUpOnce, LastScheduledAt: &lastWeek},
+		{Name: "no-catch-up", Enabled: true, CronExpr: "0 0 3 * * *", CatchUpPolicy: CatchUpNone, LastScheduledAt: &lastWeek},
+		{Name: "disabled", Enabled: false, RunOnStartup: true},
+	}
+	for _, m := range mappings {
+		if err := s.db.CreateMapping(m); err != nil {
+			t.Fatalf("failed to create mapping: %v", err)
+		}
+	}
+	// Enabled defaults to true on create
+	mappings[3].Enabled = false
+	if err := s.db.UpdateMapping(mappings[3]); err != nil {
+		t.Fatalf("failed to update mapping: %v", err)
+	}
+
+	s.runOnStartup(mappings)
+	s.catchUpMissedRuns(mappings)
+
+	_, pending := s.queue.snapshot()
+	var got []string
+	for _, job := range pending {
+		got = append(got, job.Mapping+":"+job.Trigger)
+	}
+	if want := "[startup:startup missed:cron]"; fmt.Sprint(got) != want {
+		t.Errorf("queued = %v, want %s", got, want)
+	}
+	for _, name := range []string{"startup", "missed"} {
+		m, _ := s.db.GetMappingByName(name)
+		if m.LastScheduledAt == nil || !m.LastScheduledAt.After(lastWeek) {
+			t.Errorf("%s: last scheduled time not updated: %v", name, m.LastScheduledAt)
+		}
+	}
+}
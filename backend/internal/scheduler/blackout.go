@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// blackoutWindow is a daily window in minutes after midnight; a window whose
+// end is before its start spans midnight
+type blackoutWindow struct {
+	start, end int
+}
+
+// parseBlackoutWindows parses comma-separated "HH:MM-HH:MM" windows
+func parseBlackoutWindows(s string) ([]blackoutWindow, error) {
+	var windows []blackoutWindow
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid blackout window %q: want HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %w", part, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %w", part, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid blackout window %q: empty window", part)
+		}
+		windows = append(windows, blackoutWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateBlackoutWindows checks a mapping's blackout windows
+func ValidateBlackoutWindows(s string) error {
+	_, err := parseBlackoutWindows(s)
+	return err
+}
+
+// LoadTimezone returns the location of a mapping's timezone; empty is the
+// process's local time
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// cronSpec returns the cron spec of an expression evaluated in timezone
+func cronSpec(cronExpr, timezone string) string {
+	if timezone == "" || strings.HasPrefix(cronExpr, "CRON_TZ=") || strings.HasPrefix(cronExpr, "TZ=") {
+		return cronExpr
+	}
+	return "CRON_TZ=" + timezone + " " + cronExpr
+}
+
+// blackoutEnd returns when the blackout window containing now ends; ok is
+// false outside all windows. Overlapping or adjacent windows are followed
+// to their combined end.
+func blackoutEnd(windows []blackoutWindow, now time.Time) (end time.Time, ok bool) {
+	end = now
+	for i := 0; i <= len(windows); i++ {
+		next, in := windowEnd(windows, end)
+		if !in {
+			break
+		}
+		end, ok = next, true
+	}
+	return end, ok
+}
+
+// windowEnd returns the end of the first window containing t
+func windowEnd(windows []blackoutWindow, t time.Time) (time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	minute := t.Hour()*60 + t.Minute()
+	at := func(day, minutes int) time.Time {
+		return midnight.AddDate(0, 0, day).Add(time.Duration(minutes) * time.Minute)
+	}
+	for _, w := range windows {
+		switch {
+		case w.start < w.end && minute >= w.start && minute < w.end:
+			return at(0, w.end), true
+		case w.start > w.end && minute >= w.start:
+			return at(1, w.end), true
+		case w.start > w.end && minute < w.end:
+			return at(0, w.end), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// deferredJob is a run held back until the blackout window of its mapping
+// ends, until its retry is due, or for the jitter of a scheduled run
+type deferredJob struct {
+	task    *storage.Task
+	trigger string
+	opts    RunOptions
+	timer   *time.Timer
+}
+
+// deferredUntil returns when a run of the named mapping with the given
+// trigger may start; ok is false when it may start now. Only scheduled,
+// webhook and retry runs are deferred.
+func (s *Scheduler) deferredUntil(name, trigger string) (time.Time, bool) {
+	switch trigger {
+	case TriggerCron, TriggerStartup, TriggerWebhook, TriggerRetry:
+	default:
+		return time.Time{}, false
+	}
+	mapping, err := s.db.GetMappingByName(name)
+	if err != nil || mapping.BlackoutWindows == "" {
+		return time.Time{}, false
+	}
+	windows, err := parseBlackoutWindows(mapping.BlackoutWindows)
+	if err != nil {
+		log.Printf("[Scheduler] WARNING: Ignoring blackout windows of mapping %s: %v", name, err)
+		return time.Time{}, false
+	}
+	loc, err := LoadTimezone(mapping.Timezone)
+	if err != nil {
+		log.Printf("[Scheduler] WARNING: Unknown timezone %q of mapping %s, using local time", mapping.Timezone, name)
+		loc = time.Local
+	}
+	return blackoutEnd(windows, time.Now().In(loc))
+}
+
+// deferJob holds a job back until until; the task stays queued and is
+// recovered on the next start if the process stops before
+func (s *Scheduler) deferJob(task *storage.Task, trigger string, opts RunOptions, until time.Time, reason string) {
+	job := &deferredJob{task: task, trigger: trigger, opts: opts}
+	s.deferMu.Lock()
+	if s.deferred == nil {
+		s.deferred = make(map[string]*deferredJob)
+	}
+	s.deferred[task.TaskID] = job
+	job.timer = time.AfterFunc(time.Until(until), func() { s.releaseJob(job) })
+	s.deferMu.Unlock()
+	log.Printf("[TraceID: %s] Task deferred by %s until %s: mapping=%s, trigger=%s",
+		task.TaskID[:min(8, len(task.TaskID))], reason, until.Format("2006-01-02 15:04:05 MST"), task.ConfigName, trigger)
+}
+
+// releaseJob queues a deferred job once it is due
+func (s *Scheduler) releaseJob(job *deferredJob) {
+	s.deferMu.Lock()
+	if s.deferred[job.task.TaskID] != job {
+		// Cancelled or discarded on shutdown
+		s.deferMu.Unlock()
+		return
+	}
+	delete(s.deferred, job.task.TaskID)
+	s.deferMu.Unlock()
+
+	// The mapping may have been deleted or disabled in the meantime
+	if job.trigger == TriggerCron {
+		if mapping, err := s.db.GetMappingByName(job.task.ConfigName); err != nil || !mapping.Enabled {
+			log.Printf("[TraceID: %s] Deferred scheduled run dropped: mapping %s was deleted or disabled",
+				job.task.TaskID[:min(8, len(job.task.TaskID))], job.task.ConfigName)
+			s.finishUnstarted(job.task, job.task.TaskID[:min(8, len(job.task.TaskID))], storage.TaskStatusCancelled, "mapping deleted or disabled")
+			return
+		}
+	}
+
+	if err := s.pushJob(job.task, job.trigger, job.opts); err != nil {
+		// The task stays queued and is recovered on the next start
+		log.Printf("[TraceID: %s] Failed to queue deferred task: %v", job.task.TaskID[:8], err)
+	}
+}
+
+// cancelDeferred cancels a deferred job that has not been queued yet
+func (s *Scheduler) cancelDeferred(taskID string) bool {
+	s.deferMu.Lock()
+	defer s.deferMu.Unlock()
+
+	job, ok := s.deferred[taskID]
+	if ok {
+		job.timer.Stop()
+		delete(s.deferred, taskID)
+	}
+	return ok
+}
+
+// cancelDeferredTrigger cancels the deferred jobs of the named mapping with
+// the given trigger and records their tasks as cancelled
+func (s *Scheduler) cancelDeferredTrigger(name, trigger, reason string) {
+	s.deferMu.Lock()
+	var cancelled []*storage.Task
+	for taskID, job := range s.deferred {
+		if job.task.ConfigName == name && job.trigger == trigger {
+			job.timer.Stop()
+			delete(s.deferred, taskID)
+			cancelled = append(cancelled, job.task)
+		}
+	}
+	s.deferMu.Unlock()
+
+	for _, task := range cancelled {
+		traceID := task.TaskID[:min(8, len(task.TaskID))]
+		log.Printf("[TraceID: %s] Deferred task cancelled: %s", traceID, reason)
+		s.finishUnstarted(task, traceID, storage.TaskStatusCancelled, reason)
+	}
+}
+
+// dropDeferred discards deferred jobs on shutdown. Their tasks stay queued
+// and are recovered on the next start.
+func (s *Scheduler) dropDeferred() {
+	s.deferMu.Lock()
+	defer s.deferMu.Unlock()
+
+	for taskID, job := range s.deferred {
+		job.timer.Stop()
+		delete(s.deferred, taskID)
+	}
+}
+
+// cronJitter returns a random delay of up to jitter seconds
+func cronJitter(jitter int) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(jitter)*int64(time.Second) + 1))
+}
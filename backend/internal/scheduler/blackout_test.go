@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestBlackoutEnd(t *testing.T) {
+	windows, err := parseBlackoutWindows("19:00-23:00, 22:30-01:00, 12:00-13:00")
+	if err != nil {
+		t.Fatalf("parseBlackoutWindows: %v", err)
+	}
+	day := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 3, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		now  time.Time
+		want time.Time // zero when outside all windows
+	}{
+		{day(10, 0), time.Time{}},
+		{day(12, 30), day(13, 0)},
+		{day(13, 0), time.Time{}},
+		{day(20, 0), day(25, 0)}, // runs on into the overnight window
+		{day(0, 30), day(1, 0)},
+	}
+	for _, tt := range tests {
+		got, ok := blackoutEnd(windows, tt.now)
+		if ok != !tt.want.IsZero() || (ok && !got.Equal(tt.want)) {
+			t.Errorf("blackoutEnd(%s) = %s, %v; want %s", tt.now.Format("15:04"), got, ok, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"19:00", "25:00-26:00", "10:00-10:00"} {
+		if err := ValidateBlackoutWindows(invalid); err == nil {
+			t.Errorf("ValidateBlackoutWindows(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestPushJob_DefersDuringBlackout(t *testing.T) {
+	s := newTestScheduler(t)
+	now := time.Now()
+	window := now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", BlackoutWindows: window}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	cronTask, err := s.Enqueue(context.Background(), "movies", TriggerCron, RunOptions{})
+	if err != nil {
+		t.Fatalf("Enqueue cron: %v", err)
+	}
+	manualTask, err := s.Enqueue(context.Background(), "movies", TriggerManual, RunOptions{})
+	if err != nil {
+		t.Fatalf("Enqueue manual: %v", err)
+	}
+
+	_, pending := s.queue.snapshot()
+	if len(pending) != 1 || pending[0].TaskID != manualTask {
+		t.Fatalf("only the manual run should be queued, got %+v", pending)
+	}
+	if _, ok := s.deferred[cronTask]; !ok {
+		t.Fatal("cron run should be deferred")
+	}
+
+	status, err := s.CancelTask(cronTask)
+	if err != nil || status != storage.TaskStatusCancelled {
+		t.Fatalf("CancelTask = %s, %v; want cancelled", status, err)
+	}
+	if len(s.deferred) != 0 {
+		t.Error("cancelled run should leave the deferred jobs")
+	}
+}
+
+func TestRunJob_DefersWhenBlackoutStarted(t *testing.T) {
+	s := newTestScheduler(t)
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+	taskID, err := s.Enqueue(context.Background(), "movies", TriggerCron, RunOptions{})
+	if err != nil {
+		t.Fatalf("Enqueue cron: %v", err)
+	}
+
+	// The blackout window starts while the job waits for a worker
+	now := time.Now()
+	mapping, _ := s.db.GetMappingByName("movies")
+	mapping.BlackoutWindows = now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")
+	if err := s.db.UpdateMapping(mapping); err != nil {
+		t.Fatalf("failed to update mapping: %v", err)
+	}
+
+	job := s.queue.pop()
+	s.runJob(job)
+	s.queue.done(job)
+
+	if _, ok := s.deferred[taskID]; !ok {
+		t.Fatal("job popped during a blackout window should be deferred again")
+	}
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil || task.Status != storage.TaskStatusQueued {
+		t.Errorf("task status = %v, %v; want %s", task, err, storage.TaskStatusQueued)
+	}
+	s.cancelDeferred(taskID)
+}
+
+func TestRunScheduled_JitterDoesNotBlockShutdown(t *testing.T) {
+	s := newTestScheduler(t)
+	mapping := &storage.Mapping{Name: "movies", Enabled: true, Jitter: 3600}
+	if err := s.db.CreateMapping(mapping); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	start := time.Now()
+	s.runScheduled(mapping.ID, "movies")
+	if len(s.deferred) != 1 {
+		t.Fatalf("jittered run should be deferred, got %d deferred jobs", len(s.deferred))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v with a jittered run pending", elapsed)
+	}
+	if len(s.deferred) != 0 {
+		t.Error("Shutdown should drop the jittered run")
+	}
+}
+
+func TestRemoveCronJob_CancelsJitteredRun(t *testing.T) {
+	s := newTestScheduler(t)
+	s.cronJobs = make(map[uint]cron.EntryID)
+	s.cron = cron.New(cron.WithSeconds())
+	mapping := &storage.Mapping{Name: "movies", Enabled: true, Jitter: 3600}
+	if err := s.db.CreateMapping(mapping); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	s.runScheduled(mapping.ID, "movies")
+	var taskID string
+	for id := range s.deferred {
+		taskID = id
+	}
+	s.RemoveCronJob(mapping.ID)
+
+	if len(s.deferred) != 0 {
+		t.Fatal("removing the cron job should cancel the jittered run")
+	}
+	if task, err := s.db.GetTaskByID(taskID); err != nil || task.Status != storage.TaskStatusCancelled {
+		t.Errorf("task = %v, %v; want cancelled", task, err)
+	}
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// Catch-up policies for cron slots missed while the process was down
+const (
+	CatchUpNone = "none" // wait for the next slot
+	CatchUpOnce = "once" // run once at startup, however many slots were missed
+)
+
+// ValidCatchUpPolicy reports whether policy is a known catch-up policy
+func ValidCatchUpPolicy(policy string) bool {
+	switch policy {
+	case CatchUpNone, CatchUpOnce:
+		return true
+	}
+	return false
+}
+
+// missedSlot returns the first slot of cronExpr in timezone after lastFired that passed
+// before now; ok is false when no slot was missed
+func missedSlot(cronExpr, timezone string, lastFired, now time.Time) (slot time.Time, ok bool, err error) {
+	schedule, err := CronParser.Parse(cronSpec(cronExpr, timezone))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	slot = schedule.Next(lastFired)
+	return slot, !slot.IsZero() && slot.Before(now), nil
+}
+
+// catchUpMissedRuns queues one cron run for each scheduled mapping whose
+// schedule fired while the process was down. Mappings that never fired get
+// the current time as the baseline for the next startup.
+func (s *Scheduler) catchUpMissedRuns(mappings []*storage.Mapping) {
+	now := time.Now()
+	for _, mapping := range mappings {
+		if !mapping.Enabled || mapping.CronExpr == "" {
+			continue
+		}
+		if mapping.LastScheduledAt == nil {
+			if err := s.db.UpdateMappingScheduledAt(mapping.ID, now); err != nil {
+				log.Printf("[Scheduler] WARNING: Failed to record schedule baseline for mapping %s: %v", mapping.Name, err)
+			}
+			continue
+		}
+
+		slot, missed, err := missedSlot(mapping.CronExpr, mapping.Timezone, *mapping.LastScheduledAt, now)
+		if err != nil {
+			log.Printf("[Scheduler] WARNING: Cannot check missed runs of mapping %s: invalid cron expression %q: %v",
+				mapping.Name, mapping.CronExpr, err)
+			continue
+		}
+		if !missed {
+			continue
+		}
+		if mapping.RunOnStartup {
+			// The startup run covers the missed slot
+			log.Printf("[Scheduler] Mapping %s missed its scheduled run at %s, covered by its startup run",
+				mapping.Name, slot.Format("2006-01-02 15:04:05"))
+			if err := s.db.UpdateMappingScheduledAt(mapping.ID, now); err != nil {
+				log.Printf("[Scheduler] WARNING: Failed to record catch-up for mapping %s: %v", mapping.Name, err)
+			}
+			continue
+		}
+		if mapping.CatchUpPolicy == CatchUpNone {
+			log.Printf("[Scheduler] Mapping %s missed its scheduled run at %s, catch-up disabled",
+				mapping.Name, slot.Format("2006-01-02 15:04:05"))
+			continue
+		}
+
+		log.Printf("[Scheduler] Mapping %s missed its scheduled run at %s, catching up",
+			mapping.Name, slot.Format("2006-01-02 15:04:05"))
+		if err := s.db.UpdateMappingScheduledAt(mapping.ID, now); err != nil {
+			log.Printf("[Scheduler] WARNING: Failed to record catch-up for mapping %s: %v", mapping.Name, err)
+		}
+		if taskID, err := s.Enqueue(context.Background(), mapping.Name, TriggerCron, RunOptions{}); err != nil {
+			log.Printf("[Scheduler] Catch-up task FAILED to queue for mapping %s: %v", mapping.Name, err)
+		} else {
+			log.Printf("[Scheduler] Catch-up task QUEUED for mapping %s: task=%s", mapping.Name, taskID)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissedSlot(t *testing.T) {
+	lastFired := time.Date(2024, 6, 3, 3, 0, 0, 0, time.Local) // Monday 03:00
+	tests := []struct {
+		name     string
+		cronExpr string
+		now      time.Time
+		want     bool
+	}{
+		{"daily, down over a slot", "0 0 3 * * *", lastFired.Add(25 * time.Hour), true},
+		{"daily, back before the next slot", "0 0 3 * * *", lastFired.Add(23 * time.Hour), false},
+		{"weekly, down for a day", "0 0 3 * * 1", lastFired.Add(24 * time.Hour), false},
+		{"weekly, down over a week", "0 0 3 * * 1", lastFired.Add(8 * 24 * time.Hour), true},
+		{"descriptor, down over a slot", "@daily", lastFired.Add(48 * time.Hour), true},
+		{"interval, back before the next slot", "@every 2h", lastFired.Add(time.Hour), false},
+		{"interval, down over a slot", "@every 2h", lastFired.Add(3 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		_, got, err := missedSlot(tt.cronExpr, "", lastFired, tt.now)
+		if err != nil {
+			t.Errorf("%s: missedSlot() error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: missed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, _, err := missedSlot("not a cron", "", lastFired, lastFired.Add(48*time.Hour)); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
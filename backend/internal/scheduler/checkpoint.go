@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// Finished directories are written in batches of checkpointBatchSize rows,
+// or after checkpointFlushInterval; a crash only loses the unwritten ones
+const (
+	checkpointBatchSize     = 200
+	checkpointFlushInterval = 5 * time.Second
+)
+
+// checkpoint adapts the task_checkpoints table to strm.Checkpoint. Finished
+// directories of earlier attempts are loaded once when a task is resumed;
+// directories finished by the current attempt are only written, in batches.
+type checkpoint struct {
+	db      *storage.DB
+	taskID  string
+	traceID string
+
+	mu      sync.Mutex
+	done    map[string][]string // finished dir -> subdirs (nil when unknown)
+	subtree map[string]bool     // memoized SubtreeDone results
+
+	saveMu    sync.Mutex
+	unsaved   []*storage.TaskCheckpoint
+	lastFlush time.Time
+}
+
+// newCheckpoint creates the checkpoint of a task, loading the directories
+// finished by earlier attempts when resume is set
+func newCheckpoint(db *storage.DB, taskID, traceID string, resume bool) (*checkpoint, error) {
+	c := &checkpoint{
+		db:      db,
+		taskID:  taskID,
+		traceID: traceID,
+		done:    make(map[string][]string),
+		subtree: make(map[string]bool),
+
+		lastFlush: time.Now(),
+	}
+	if !resume {
+		return c, nil
+	}
+
+	rows, err := db.ListTaskCheckpoints(taskID)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		var subdirs []string
+		if err := json.Unmarshal([]byte(row.Subdirs), &subdirs); err != nil {
+			log.Printf("[TraceID: %s] WARNING: Ignoring corrupt checkpoint for %s: %v", traceID, row.Dir, err)
+			continue
+		}
+		c.done[row.Dir] = subdirs
+	}
+	return c, nil
+}
+
+// resumedDirs returns the number of directories finished by earlier attempts
+func (c *checkpoint) resumedDirs() int {
+	return len(c.done)
+}
+
+// DirDone reports whether an earlier attempt finished dir
+func (c *checkpoint) DirDone(dir string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.done[dir]
+	return ok
+}
+
+// SubtreeDone reports whether an earlier attempt finished dir and, as far
+// as its recorded subdirectories tell, everything below it
+func (c *checkpoint) SubtreeDone(dir string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subtreeDoneLocked(dir)
+}
+
+func (c *checkpoint) subtreeDoneLocked(dir string) bool {
+	if done, ok := c.subtree[dir]; ok {
+		return done
+	}
+	subdirs, ok := c.done[dir]
+	done := ok && subdirs != nil
+	for _, sub := range subdirs {
+		if !done {
+			break
+		}
+		done = c.subtreeDoneLocked(sub)
+	}
+	c.subtree[dir] = done
+	return done
+}
+
+// MarkDir records a finished directory; failures only cost redoing it on resume
+func (c *checkpoint) MarkDir(dir string, subdirs []string) {
+	data, err := json.Marshal(subdirs)
+	if err != nil {
+		return
+	}
+
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.unsaved = append(c.unsaved, &storage.TaskCheckpoint{
+		TaskID:  c.taskID,
+		Dir:     dir,
+		Subdirs: string(data),
+	})
+	if len(c.unsaved) >= checkpointBatchSize || time.Since(c.lastFlush) >= checkpointFlushInterval {
+		c.flushLocked()
+	}
+}
+
+// flush writes the directories recorded since the last write
+func (c *checkpoint) flush() {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.flushLocked()
+}
+
+func (c *checkpoint) flushLocked() {
+	c.lastFlush = time.Now()
+	if len(c.unsaved) == 0 {
+		return
+	}
+	if err := c.db.SaveTaskCheckpoints(c.unsaved); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to save %d checkpoints: %v", c.traceID, len(c.unsaved), err)
+	}
+	c.unsaved = nil
+}
+
+// clear deletes the checkpoints of a task that no longer needs resuming
+func (c *checkpoint) clear() {
+	c.saveMu.Lock()
+	c.unsaved = nil
+	c.saveMu.Unlock()
+	if err := c.db.DeleteTaskCheckpoints(c.taskID); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to delete checkpoints: %v", c.traceID, err)
+	}
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestCheckpoint_SubtreeDone(t *testing.T) {
+	s := newTestScheduler(t)
+
+	first, err := newCheckpoint(s.db, "task-1", "task-1", false)
+	if err != nil {
+		t.Fatalf("newCheckpoint() error = %v", err)
+	}
+	first.MarkDir("/media", []string{"/media/a", "/media/b"})
+	first.MarkDir("/media/a", []string{"/media/a/s1"})
+	first.MarkDir("/media/a/s1", []string{})
+	first.MarkDir("/media/c", nil) // found through the search index
+	first.flush()
+
+	resumed, err := newCheckpoint(s.db, "task-1", "task-1", true)
+	if err != nil {
+		t.Fatalf("newCheckpoint() error = %v", err)
+	}
+	tests := []struct {
+		dir     string
+		dirDone bool
+		subtree bool
+	}{
+		{dir: "/media", dirDone: true, subtree: false}, // /media/b unfinished
+		{dir: "/media/a", dirDone: true, subtree: true},
+		{dir: "/media/a/s1", dirDone: true, subtree: true},
+		{dir: "/media/b", dirDone: false, subtree: false},
+		{dir: "/media/c", dirDone: true, subtree: false}, // subdirs unknown
+	}
+	for _, tt := range tests {
+		if got := resumed.DirDone(tt.dir); got != tt.dirDone {
+			t.Errorf("DirDone(%s) = %v, want %v", tt.dir, got, tt.dirDone)
+		}
+		if got := resumed.SubtreeDone(tt.dir); got != tt.subtree {
+			t.Errorf("SubtreeDone(%s) = %v, want %v", tt.dir, got, tt.subtree)
+		}
+	}
+
+	// Other tasks and fresh runs start empty
+	if other, _ := newCheckpoint(s.db, "task-2", "task-2", true); other.DirDone("/media") {
+		t.Error("checkpoints must not leak between tasks")
+	}
+	resumed.clear()
+	if again, _ := newCheckpoint(s.db, "task-1", "task-1", true); again.resumedDirs() != 0 {
+		t.Error("expected checkpoints to be cleared")
+	}
+}
+
+func TestPruneTaskCheckpoints(t *testing.T) {
+	s := newTestScheduler(t)
+	s.cfg.Scheduler.CheckpointRetention = 24
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, task := range []*storage.Task{
+		{TaskID: "completed", Status: storage.TaskStatusCompleted, CompletedAt: &now},
+		{TaskID: "failed-recent", Status: storage.TaskStatusFailed, CompletedAt: &now},
+		{TaskID: "failed-old", Status: storage.TaskStatusFailed, CompletedAt: &old},
+		{TaskID: "running", Status: storage.TaskStatusRunning},
+	} {
+		task.ConfigName = "movies"
+		task.StartedAt = now
+		if err := s.db.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+	var rows []*storage.TaskCheckpoint
+	for _, taskID := range []string{"completed", "failed-recent", "failed-old", "running", "deleted"} {
+		rows = append(rows, &storage.TaskCheckpoint{TaskID: taskID, Dir: "/media", Subdirs: "[]"})
+	}
+	if err := s.db.SaveTaskCheckpoints(rows); err != nil {
+		t.Fatalf("SaveTaskCheckpoints() error = %v", err)
+	}
+
+	left := func() string {
+		var ids []string
+		for _, taskID := range []string{"completed", "failed-recent", "failed-old", "running", "deleted"} {
+			if rows, _ := s.db.ListTaskCheckpoints(taskID); len(rows) > 0 {
+				ids = append(ids, taskID)
+			}
+		}
+		return fmt.Sprint(ids)
+	}
+
+	s.pruneCheckpoints()
+	if got, want := left(), "[failed-recent running]"; got != want {
+		t.Fatalf("checkpoints left after pruning = %s, want %s", got, want)
+	}
+
+	// A completed run of the whole mapping supersedes its stopped tasks
+	if err := s.db.DeleteStoppedTaskCheckpoints("movies", "running"); err != nil {
+		t.Fatalf("DeleteStoppedTaskCheckpoints() error = %v", err)
+	}
+	if got, want := left(), "[running]"; got != want {
+		t.Errorf("checkpoints left after a completed run = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// webhookBatch collects webhook triggers of one mapping during the debounce
+// window; all of them share its task
+type webhookBatch struct {
+	key    string
+	task   *storage.Task
+	opts   RunOptions // overrides shared by every trigger of the batch
+	whole  bool       // a trigger asked for the whole mapping
+	paths  []string
+	events int
+	timer  *time.Timer
+}
+
+// batchKey groups triggers that can share a run: same mapping and overrides
+func batchKey(name string, opts RunOptions) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%v|%v", name, opts.Mode, opts.STRMMode, opts.Concurrent, opts.DryRun, opts.Refresh)
+}
+
+// EnqueueWebhook queues a webhook-triggered run. With a debounce window,
+// triggers of the same mapping arriving within the window are merged into a
+// single task whose subpaths cover all of them; every caller gets the same
+// task ID and the run is queued when the window closes.
+func (s *Scheduler) EnqueueWebhook(ctx context.Context, name string, opts RunOptions) (string, error) {
+	if s.debounceWindow <= 0 {
+		return s.Enqueue(ctx, name, TriggerWebhook, opts)
+	}
+	if s.queue.isClosed() {
+		return "", ErrShuttingDown
+	}
+
+	key := batchKey(name, opts)
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	batch, ok := s.batches[key]
+	if !ok {
+		task, err := s.newQueuedTask(ctx, name, TriggerWebhook, opts)
+		if err != nil {
+			return "", err
+		}
+		batch = &webhookBatch{key: key, task: task, opts: opts}
+		batch.opts.Subpaths = nil
+		batch.opts.RefreshPaths = nil
+		if s.batches == nil {
+			s.batches = make(map[string]*webhookBatch)
+		}
+		s.batches[key] = batch
+		batch.timer = time.AfterFunc(s.debounceWindow, func() { s.flushBatch(batch) })
+		log.Printf("[TraceID: %s] Webhook batch opened: mapping=%s, window=%v", task.TaskID[:8], name, s.debounceWindow)
+	}
+
+	batch.events++
+	if len(opts.Subpaths) == 0 {
+		batch.whole = true
+	}
+	batch.paths = append(batch.paths, opts.Subpaths...)
+	batch.opts.RefreshPaths = mergeSubpaths(append(batch.opts.RefreshPaths, opts.RefreshPaths...))
+	batch.task.RefreshPaths = strings.Join(batch.opts.RefreshPaths, "\n")
+	batch.task.Refresh = batch.opts.Refresh || len(batch.opts.RefreshPaths) > 0
+	if !batch.whole {
+		batch.task.Subpaths = strings.Join(mergeSubpaths(batch.paths), "\n")
+	} else {
+		batch.task.Subpaths = ""
+	}
+	// Recorded so that a batch lost on shutdown is recovered with its paths
+	if err := s.db.UpdateTask(batch.task); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to update task record: %v", batch.task.TaskID[:8], err)
+	}
+	return batch.task.TaskID, nil
+}
+
+// flushBatch closes a batch and queues its run
+func (s *Scheduler) flushBatch(batch *webhookBatch) {
+	s.batchMu.Lock()
+	if s.batches[batch.key] != batch {
+		// Cancelled or discarded on shutdown
+		s.batchMu.Unlock()
+		return
+	}
+	delete(s.batches, batch.key)
+	s.batchMu.Unlock()
+
+	opts := batch.opts
+	if !batch.whole {
+		opts.Subpaths = mergeSubpaths(batch.paths)
+	}
+	traceID := batch.task.TaskID[:8]
+	log.Printf("[TraceID: %s] Webhook batch closed: %d events merged into subpaths %v", traceID, batch.events, opts.Subpaths)
+	if err := s.pushJob(batch.task, TriggerWebhook, opts); err != nil {
+		// The task stays queued and is recovered on the next start
+		log.Printf("[TraceID: %s] Failed to queue webhook batch: %v", traceID, err)
+	}
+}
+
+// cancelBatch cancels a webhook batch that has not been queued yet
+func (s *Scheduler) cancelBatch(taskID string) (*storage.Task, bool) {
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	for key, batch := range s.batches {
+		if batch.task.TaskID == taskID {
+			batch.timer.Stop()
+			delete(s.batches, key)
+			return batch.task, true
+		}
+	}
+	return nil, false
+}
+
+// dropBatches stops collecting webhook triggers on shutdown. Their tasks
+// stay queued and are recovered on the next start.
+func (s *Scheduler) dropBatches() {
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	for key, batch := range s.batches {
+		batch.timer.Stop()
+		delete(s.batches, key)
+	}
+}
+
+// mergeSubpaths returns the minimal set of paths covering all of paths:
+// duplicates and paths below another listed path are dropped
+func mergeSubpaths(paths []string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	var merged []string
+	for _, p := range sorted {
+		covered := false
+		for _, m := range merged {
+			if alist.IsWithin(p, m) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
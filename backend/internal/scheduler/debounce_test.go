@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestMergeSubpaths(t *testing.T) {
+	got := mergeSubpaths([]string{"/media/show/s01/e02.mkv", "/media/show", "/media/movie.mkv", "/media/show/s01", "/media/movie.mkv", "/media/shows"})
+	want := []string{"/media/movie.mkv", "/media/show", "/media/shows"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("mergeSubpaths() = %v, want %v", got, want)
+	}
+}
+
+func TestEnqueueWebhook_Debounces(t *testing.T) {
+	s := newTestScheduler(t)
+	s.debounceWindow = 200 * time.Millisecond
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", Source: "/media", Target: "/strm"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	var ids []string
+	for _, p := range []string{"/media/show/e01.mkv", "/media/show/e02.mkv", "/media/show"} {
+		id, err := s.EnqueueWebhook(context.Background(), "movies", RunOptions{Subpaths: []string{p}})
+		if err != nil {
+			t.Fatalf("EnqueueWebhook failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// Different overrides cannot share a run
+	dryID, _ := s.EnqueueWebhook(context.Background(), "movies", RunOptions{DryRun: true, Subpaths: []string{"/media/other"}})
+
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Fatalf("expected a shared task ID, got %v", ids)
+	}
+	if dryID == ids[0] {
+		t.Fatal("expected a separate task for different overrides")
+	}
+	if _, pending := s.queue.snapshot(); len(pending) != 0 {
+		t.Fatalf("expected nothing queued before the window closes, got %d jobs", len(pending))
+	}
+
+	waitFor(t, func() bool {
+		_, pending := s.queue.snapshot()
+		return len(pending) == 2
+	})
+	_, pending := s.queue.snapshot()
+	for _, job := range pending {
+		if job.TaskID == ids[0] && fmt.Sprint(job.Opts.Subpaths) != "[/media/show]" {
+			t.Fatalf("expected merged subpaths [/media/show], got %v", job.Opts.Subpaths)
+		}
+	}
+	if task, _ := s.db.GetTaskByID(ids[0]); task.Status != storage.TaskStatusQueued || task.Subpaths != "/media/show" {
+		t.Fatalf("expected queued task limited to /media/show, got %+v", task)
+	}
+}
+
+func TestCancelTask_WebhookBatch(t *testing.T) {
+	s := newTestScheduler(t)
+	s.debounceWindow = time.Hour
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", Source: "/media", Target: "/strm"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	id, err := s.EnqueueWebhook(context.Background(), "movies", RunOptions{})
+	if err != nil {
+		t.Fatalf("EnqueueWebhook failed: %v", err)
+	}
+	if status, err := s.CancelTask(id); err != nil || status != storage.TaskStatusCancelled {
+		t.Fatalf("expected cancelled, got %q, %v", status, err)
+	}
+
+	// A later trigger opens a new batch
+	next, _ := s.EnqueueWebhook(context.Background(), "movies", RunOptions{})
+	if next == id {
+		t.Fatal("expected a new task after cancelling the batch")
+	}
+}
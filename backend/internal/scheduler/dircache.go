@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// defaultDeepScanInterval is used when a cached mapping has no interval set
+const defaultDeepScanInterval = 24 * time.Hour
+
+// dirCache adapts the dir_listings table to alist.DirCache
+type dirCache struct {
+	db      *storage.DB
+	read    bool // serve cached listings; false only refreshes the cache
+	write   bool // store fresh listings; false for dry runs
+	traceID string
+	hits    int64
+}
+
+func newDirCache(db *storage.DB, read, write bool, traceID string) *dirCache {
+	return &dirCache{db: db, read: read, write: write, traceID: traceID}
+}
+
+// walkCache returns c as an alist.DirCache, or nil when caching is off or
+// the cache would be neither read nor written
+func (c *dirCache) walkCache() alist.DirCache {
+	if c == nil || (!c.read && !c.write) {
+		return nil
+	}
+	return c
+}
+
+// GetDir returns the stored listing of dir if its modified time is unchanged.
+// The walk passes modified times from fresh parent listings only, see
+// alist.DirCache for the changes this can miss.
+func (c *dirCache) GetDir(dir string, modified time.Time) ([]alist.FileItem, bool) {
+	if !c.read {
+		return nil, false
+	}
+
+	listing, err := c.db.GetDirListing(dir)
+	if err != nil || !listing.Modified.Equal(modified) {
+		return nil, false
+	}
+
+	var entries []alist.FileItem
+	if err := json.Unmarshal([]byte(listing.Entries), &entries); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Discarding corrupt listing cache for %s: %v", c.traceID, dir, err)
+		return nil, false
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+	return entries, true
+}
+
+// PutDir stores a fresh listing of dir; failures only cost a future cache miss
+func (c *dirCache) PutDir(dir string, modified time.Time, entries []alist.FileItem) {
+	if !c.write {
+		return
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to encode listing of %s: %v", c.traceID, dir, err)
+		return
+	}
+
+	if err := c.db.SaveDirListing(&storage.DirListing{
+		Path:     dir,
+		Modified: modified,
+		Entries:  string(data),
+	}); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to cache listing of %s: %v", c.traceID, dir, err)
+	}
+}
+
+func (c *dirCache) hitCount() int64 {
+	return atomic.LoadInt64(&c.hits)
+}
+
+// deepScanDue reports whether a cached mapping needs a full uncached scan
+func deepScanDue(mapping config.MappingConfig, now time.Time) bool {
+	if mapping.LastDeepScanAt == nil {
+		return true
+	}
+	interval := mapping.DeepScanInterval
+	if interval <= 0 {
+		interval = defaultDeepScanInterval
+	}
+	return now.Sub(*mapping.LastDeepScanAt) >= interval
+}
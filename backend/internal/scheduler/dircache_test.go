@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+)
+
+func TestDirCache_DryRunDoesNotWrite(t *testing.T) {
+	s := newTestScheduler(t)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []alist.FileItem{{Name: "movie.mp4"}}
+
+	dryRun := newDirCache(s.db, true, false, "dry")
+	dryRun.PutDir("/media", modified, entries)
+	if _, err := s.db.GetDirListing("/media"); err == nil {
+		t.Fatal("a dry run must not store listings")
+	}
+	if newDirCache(s.db, false, false, "dry").walkCache() != nil {
+		t.Error("a cache that is neither read nor written should be off")
+	}
+
+	newDirCache(s.db, false, true, "deep").PutDir("/media", modified, entries)
+	if got, ok := dryRun.GetDir("/media", modified); !ok || len(got) != 1 {
+		t.Errorf("dry run should read stored listings, got %v, %v", got, ok)
+	}
+}
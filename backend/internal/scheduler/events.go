@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/notification"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+	"github.com/konghanghang/openlist-strm/internal/strm"
+)
+
+// File events reported by webhooks
+const (
+	EventDelete = "delete"
+	EventMove   = "move"
+)
+
+// eventPath returns the path a file event refers to; without a subpath the
+// event refers to the source itself, which the strm package refuses
+func eventPath(source string, subpaths []string) string {
+	if len(subpaths) == 0 {
+		return source
+	}
+	return subpaths[0]
+}
+
+// runDeleteEvent removes the targets of a deleted source path and notifies
+// the media server of the deletion
+func (s *Scheduler) runDeleteEvent(ctx context.Context, task *storage.Task, opts strm.GenerateOptions, p, traceID string) error {
+	target, deleted, err := s.generator.RemoveSource(ctx, opts, p, traceID)
+	task.FilesDeleted = deleted
+	s.finishEvent(task, err, traceID)
+	if err != nil {
+		return fmt.Errorf("[TraceID: %s] removing targets failed: %w", traceID, err)
+	}
+	log.Printf("[TraceID: %s] Task COMPLETED: deleted=%d for removed path %s", traceID, deleted, p)
+
+	// 通知媒体服务器路径已删除
+	if opts.DryRun || deleted == 0 {
+		log.Printf("[TraceID: %s] Nothing deleted, skipping media server notification", traceID)
+		return nil
+	}
+	updates := []notification.Update{{Path: target, UpdateType: notification.UpdateDeleted}}
+	if err := s.notifier.NotifyUpdates(ctx, updates); err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to notify media server: %v", traceID, err)
+	}
+	return nil
+}
+
+// finishEvent records the outcome of a file event that did not reach the
+// generation step
+func (s *Scheduler) finishEvent(task *storage.Task, err error, traceID string) {
+	now := time.Now()
+	task.CompletedAt = &now
+	task.Status = storage.TaskStatusCompleted
+	if err != nil {
+		task.Status = storage.TaskStatusFailed
+		task.Errors = err.Error()
+		log.Printf("[TraceID: %s] Task %s: error=%v", traceID, strings.ToUpper(task.Status), err)
+	}
+	if updateErr := s.db.UpdateTask(task); updateErr != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to update task record: %v", traceID, updateErr)
+	}
+}
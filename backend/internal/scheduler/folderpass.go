@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/secrets"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// folderPasswordEntry is a decrypted folder password
+type folderPasswordEntry struct {
+	prefix   string
+	password string
+}
+
+// folderPasswords resolves passwords of meta-protected Alist folders by
+// longest path prefix, keeping decrypted passwords in memory only
+type folderPasswords struct {
+	db  *storage.DB
+	box *secrets.Box
+
+	mu      sync.RWMutex
+	entries []folderPasswordEntry // longest prefix first
+}
+
+func newFolderPasswords(db *storage.DB, box *secrets.Box) *folderPasswords {
+	return &folderPasswords{db: db, box: box}
+}
+
+// Reload loads and decrypts all folder passwords from the database
+func (f *folderPasswords) Reload() error {
+	rows, err := f.db.ListFolderPasswords()
+	if err != nil {
+		return fmt.Errorf("failed to list folder passwords: %w", err)
+	}
+
+	entries := make([]folderPasswordEntry, 0, len(rows))
+	for _, row := range rows {
+		password, err := f.box.Decrypt(row.Password)
+		if err != nil {
+			log.Printf("[Scheduler] WARNING: Skipping folder password for %s: %v", row.PathPrefix, err)
+			continue
+		}
+		entries = append(entries, folderPasswordEntry{
+			prefix:   path.Clean(row.PathPrefix),
+			password: password,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return len(entries[i].prefix) > len(entries[j].prefix)
+	})
+
+	f.mu.Lock()
+	f.entries = entries
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Resolve returns the password for p, or "" if no prefix matches
+func (f *folderPasswords) Resolve(p string) string {
+	p = path.Clean(p)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, e := range f.entries {
+		if alist.IsWithin(p, e.prefix) {
+			return e.password
+		}
+	}
+	return ""
+}
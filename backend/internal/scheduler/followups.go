@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+	"github.com/konghanghang/openlist-strm/internal/strm"
+)
+
+// Task types
+const (
+	TaskTypeGenerate = "generate" // recorded as empty on tasks
+	TaskTypeValidate = "validate" // check the STRM files of the target
+)
+
+// Conditions of a follow-up on the task that finished
+const (
+	FollowUpAlways  = "always"  // completed or failed
+	FollowUpSuccess = "success" // completed without errors
+	FollowUpChanged = "changed" // completed and created or deleted files
+)
+
+// maxChainDepth bounds chains of follow-up tasks
+const maxChainDepth = 8
+
+// FollowUp is a task queued when a task of its mapping finishes
+type FollowUp struct {
+	Mapping  string `json:"mapping,omitempty"`   // mapping to run; empty for the same mapping
+	Task     string `json:"task,omitempty"`      // generate (default) or validate
+	When     string `json:"when,omitempty"`      // always (default), success or changed
+	FullOnly bool   `json:"full_only,omitempty"` // only after full-mode runs
+}
+
+// ParseFollowUps parses the follow-ups stored on a mapping
+func ParseFollowUps(s string) ([]FollowUp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var followUps []FollowUp
+	if err := json.Unmarshal([]byte(s), &followUps); err != nil {
+		return nil, fmt.Errorf("invalid follow-ups: %w", err)
+	}
+	return followUps, nil
+}
+
+// ValidateFollowUp checks the task type and condition of a follow-up
+func ValidateFollowUp(f FollowUp) error {
+	switch f.Task {
+	case "", TaskTypeGenerate, TaskTypeValidate:
+	default:
+		return fmt.Errorf("follow-up task must be 'generate' or 'validate'")
+	}
+	switch f.When {
+	case "", FollowUpAlways, FollowUpSuccess, FollowUpChanged:
+	default:
+		return fmt.Errorf("follow-up when must be 'always', 'success' or 'changed'")
+	}
+	return nil
+}
+
+// matches reports whether the follow-up applies to the finished task
+func (f FollowUp) matches(task *storage.Task) bool {
+	if f.FullOnly && task.Mode != "full" {
+		return false
+	}
+	switch task.Status {
+	case storage.TaskStatusCompleted:
+	case storage.TaskStatusFailed:
+		return f.When == "" || f.When == FollowUpAlways
+	default:
+		// Cancelled, skipped or interrupted tasks do not start a chain
+		return false
+	}
+	switch f.When {
+	case FollowUpSuccess:
+		return task.Errors == ""
+	case FollowUpChanged:
+		return task.FilesCreated > 0 || task.FilesDeleted > 0
+	}
+	return true
+}
+
+// taskType returns the type of a task, generate when none is recorded
+func taskType(task *storage.Task) string {
+	if task.Type == "" {
+		return TaskTypeGenerate
+	}
+	return task.Type
+}
+
+// queueFollowUps queues the follow-ups of the mapping of a finished task
+func (s *Scheduler) queueFollowUps(taskID string) {
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil || task.DryRun {
+		return
+	}
+	traceID := taskID[:min(8, len(taskID))]
+	mapping, err := s.db.GetMappingByName(task.ConfigName)
+	if err != nil || mapping.FollowUps == "" {
+		return
+	}
+	followUps, err := ParseFollowUps(mapping.FollowUps)
+	if err != nil {
+		log.Printf("[TraceID: %s] WARNING: Ignoring follow-ups of mapping %s: %v", traceID, mapping.Name, err)
+		return
+	}
+
+	for _, f := range followUps {
+		if !f.matches(task) {
+			continue
+		}
+		name := f.Mapping
+		if name == "" {
+			name = task.ConfigName
+		}
+		typ := f.Task
+		if typ == "" {
+			typ = TaskTypeGenerate
+		}
+		if reason := s.chainLoop(task, name, typ); reason != "" {
+			log.Printf("[TraceID: %s] Follow-up %s of mapping %s not queued: %s", traceID, typ, name, reason)
+			continue
+		}
+
+		opts := RunOptions{ParentTaskID: task.TaskID}
+		if typ == TaskTypeValidate {
+			opts.TaskType = TaskTypeValidate
+		}
+		followUpID, err := s.Enqueue(context.Background(), name, TriggerChain, opts)
+		if err != nil {
+			log.Printf("[TraceID: %s] Follow-up %s of mapping %s FAILED to queue: %v", traceID, typ, name, err)
+			continue
+		}
+		log.Printf("[TraceID: %s] Follow-up %s of mapping %s QUEUED: task=%s", traceID, typ, name, followUpID)
+	}
+}
+
+// chainLoop returns why a follow-up of task would loop: the same run is
+// already in its chain, or the chain is too long
+func (s *Scheduler) chainLoop(task *storage.Task, name, typ string) string {
+	for depth := 0; task != nil; depth++ {
+		if depth >= maxChainDepth {
+			return fmt.Sprintf("chain longer than %d tasks", maxChainDepth)
+		}
+		if task.ConfigName == name && taskType(task) == typ {
+			return fmt.Sprintf("task %s of the chain already ran it", task.TaskID)
+		}
+		if task.ParentTaskID == "" {
+			return ""
+		}
+		parent, err := s.db.GetTaskByID(task.ParentTaskID)
+		if err != nil {
+			return ""
+		}
+		task = parent
+	}
+	return ""
+}
+
+// runValidate checks the STRM files of a mapping's target
+func (s *Scheduler) runValidate(ctx context.Context, task *storage.Task, mapping config.MappingConfig, traceID string) error {
+	result, err := strm.Validate(ctx, strm.GenerateOptions{
+		SourcePath: mapping.Source,
+		TargetPath: mapping.Target,
+		STRMMode:   mapping.STRMMode,
+	})
+	if result != nil {
+		// Checked files are reported as skipped: nothing was written
+		task.FilesSkipped = result.FilesChecked
+		if len(result.Invalid) > 0 {
+			var msgs []string
+			for _, e := range result.Invalid {
+				msgs = append(msgs, e.Error())
+			}
+			task.Errors = strings.Join(msgs, "; ") + "; "
+		}
+	}
+	if err != nil {
+		s.finishEvent(task, err, traceID)
+		return fmt.Errorf("[TraceID: %s] validation failed: %w", traceID, err)
+	}
+	s.finishEvent(task, nil, traceID)
+	log.Printf("[TraceID: %s] Task COMPLETED: validated %d STRM files, %d invalid, duration=%v",
+		traceID, result.FilesChecked, len(result.Invalid), time.Since(task.StartedAt))
+	return nil
+}
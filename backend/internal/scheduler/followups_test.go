@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestQueueFollowUps(t *testing.T) {
+	s := newTestScheduler(t)
+	mappings := []*storage.Mapping{
+		{Name: "downloads", FollowUps: `[{"mapping":"anime","when":"changed"},{"task":"validate","full_only":true}]`},
+		{Name: "anime", FollowUps: `[{"mapping":"downloads"},{"task":"validate","when":"success"}]`},
+	}
+	for _, m := range mappings {
+		if err := s.db.CreateMapping(m); err != nil {
+			t.Fatalf("failed to create mapping: %v", err)
+		}
+	}
+	finish := func(task *storage.Task) {
+		task.StartedAt = time.Now()
+		if err := s.db.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		s.queueFollowUps(task.TaskID)
+	}
+	queued := func() []string {
+		_, pending := s.queue.snapshot()
+		var out []string
+		for _, job := range pending {
+			task, _ := s.db.GetTaskByID(job.TaskID)
+			out = append(out, fmt.Sprintf("%s:%s:%s", job.Mapping, taskType(task), task.ParentTaskID))
+		}
+		return out
+	}
+
+	// Nothing changed: no follow-up; incremental: no validation
+	finish(&storage.Task{TaskID: "unchanged", ConfigName: "downloads", Mode: "incremental", Status: storage.TaskStatusCompleted})
+	if got := queued(); len(got) != 0 {
+		t.Fatalf("queued = %v, want none", got)
+	}
+
+	finish(&storage.Task{TaskID: "parent", ConfigName: "downloads", Mode: "full", Status: storage.TaskStatusCompleted, FilesCreated: 3})
+	if got, want := fmt.Sprint(queued()), "[anime:generate:parent downloads:validate:parent]"; got != want {
+		t.Fatalf("queued = %s, want %s", got, want)
+	}
+
+	// The anime run must not start downloads again
+	_, pending := s.queue.snapshot()
+	for _, job := range pending {
+		s.queue.cancel(job.TaskID, ErrCancelled)
+	}
+	finish(&storage.Task{TaskID: "child", ConfigName: "anime", Mode: "incremental", Status: storage.TaskStatusCompleted, ParentTaskID: "parent"})
+	if got, want := fmt.Sprint(queued()), "[anime:validate:child]"; got != want {
+		t.Errorf("queued = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,484 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/konghanghang/openlist-strm/internal/contextkeys"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// Task triggers, highest priority first
+const (
+	TriggerManual  = "manual"
+	TriggerChange  = "change" // the mapping was created or edited
+	TriggerWebhook = "webhook"
+	TriggerCron    = "cron"
+	TriggerStartup = "startup"
+	TriggerChain   = "chain" // follow-up of a finished task
+	TriggerRetry   = "retry" // retry of a failed task or of its failed files
+)
+
+var (
+	// ErrTaskNotFound is returned when cancelling or resuming an unknown task
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskNotActive is returned when cancelling a task that already finished
+	ErrTaskNotActive = errors.New("task is not queued or running")
+	// ErrCancelled is the cancellation cause of tasks cancelled via the API
+	ErrCancelled = errors.New("cancelled via API")
+	// ErrTaskNotResumable is returned when resuming a task that did not stop early
+	ErrTaskNotResumable = errors.New("only failed, cancelled or interrupted tasks can be resumed")
+	// ErrShuttingDown is returned when queueing a task during shutdown
+	ErrShuttingDown = errors.New("scheduler is shutting down")
+)
+
+// defaultWorkers is the number of queue workers when none is configured
+const defaultWorkers = 2
+
+// triggerPriority orders queued jobs: manual, change > webhook, chain > cron, startup
+func triggerPriority(trigger string) int {
+	switch trigger {
+	case TriggerManual, TriggerChange:
+		return 2
+	case TriggerWebhook, TriggerChain:
+		return 1
+	}
+	return 0
+}
+
+// Job is a mapping run waiting in or taken from the queue
+type Job struct {
+	TaskID     string     `json:"task_id"`
+	Mapping    string     `json:"mapping"`
+	Trigger    string     `json:"trigger"`
+	Priority   int        `json:"priority"`
+	EnqueuedAt time.Time  `json:"enqueued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	Opts       RunOptions `json:"-"`
+
+	seq      uint64
+	ctx      context.Context // carries the task ID as trace ID
+	cancel   context.CancelCauseFunc
+	conflict string // conflict policy of the mapping when queued
+	dropped  string // why the job is dropped instead of run, set by pop
+}
+
+// jobQueue is a priority queue of jobs shared by the workers
+type jobQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Job          // sorted by priority, then enqueue order
+	running map[string]*Job // task ID -> job taken by a worker
+	active  map[string]int  // mapping -> number of its jobs taken by workers
+	seq     uint64
+	closed  bool
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{running: make(map[string]*Job), active: make(map[string]int)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a job behind all jobs of the same or higher priority
+func (q *jobQueue) push(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrShuttingDown
+	}
+	q.seq++
+	job.seq = q.seq
+	i := sort.Search(len(q.pending), func(i int) bool {
+		return q.pending[i].Priority < job.Priority
+	})
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = job
+	q.cond.Signal()
+	return nil
+}
+
+// pop blocks until a job can be taken and marks it running; it returns
+// nil once the queue is closed
+func (q *jobQueue) pop() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil
+		}
+		if i := q.next(); i >= 0 {
+			job := q.pending[i]
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			now := time.Now()
+			job.StartedAt = &now
+			q.running[job.TaskID] = job
+			q.active[job.Mapping]++
+			return job
+		}
+		q.cond.Wait()
+	}
+}
+
+// next returns the index of the first pending job a worker may take, or -1.
+// Under the queue conflict policy the first job of a running mapping waits
+// in the queue instead of holding a worker until the run ends; later jobs
+// of that mapping are taken to be dropped, as only one run may follow.
+func (q *jobQueue) next() int {
+	var parked map[string]string // mapping -> task ID of its waiting job
+	for i, job := range q.pending {
+		if q.active[job.Mapping] == 0 {
+			return i
+		}
+		switch job.conflict {
+		case ConflictSkip, ConflictCancel:
+			// Resolved right away by acquireRun
+			return i
+		}
+		if waiting, ok := parked[job.Mapping]; ok {
+			job.dropped = fmt.Sprintf("task %s is already queued for mapping %s", waiting, job.Mapping)
+			return i
+		}
+		if parked == nil {
+			parked = make(map[string]string)
+		}
+		parked[job.Mapping] = job.TaskID
+	}
+	return -1
+}
+
+// done removes a finished job from the running set and wakes the workers
+// waiting for jobs of its mapping
+func (q *jobQueue) done(job *Job) {
+	q.mu.Lock()
+	delete(q.running, job.TaskID)
+	if q.active[job.Mapping]--; q.active[job.Mapping] <= 0 {
+		delete(q.active, job.Mapping)
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+	job.cancel(nil)
+}
+
+// cancel cancels the job with the given task ID. A pending job is removed
+// from the queue; a running job is only signalled and stops on its own.
+func (q *jobQueue) cancel(taskID string, cause error) (job *Job, wasPending bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job, ok := q.running[taskID]; ok {
+		job.cancel(cause)
+		return job, false
+	}
+	for i, job := range q.pending {
+		if job.TaskID == taskID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			job.cancel(cause)
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// close wakes all workers and makes pop return nil. Pending jobs stay
+// queued in the database and are recovered on the next start.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// isClosed reports whether the queue no longer accepts jobs
+func (q *jobQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// cancelRunning cancels all running jobs with cause
+func (q *jobQueue) cancelRunning(cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.running {
+		job.cancel(cause)
+	}
+}
+
+// snapshot returns copies of the running and pending jobs
+func (q *jobQueue) snapshot() (running, pending []Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.running {
+		running = append(running, *job)
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].seq < running[j].seq })
+	for _, job := range q.pending {
+		pending = append(pending, *job)
+	}
+	return running, pending
+}
+
+// QueueStatus describes the task queue
+type QueueStatus struct {
+	Workers int   `json:"workers"`
+	Running []Job `json:"running"`
+	Queued  []Job `json:"queued"`
+}
+
+// Queue returns the jobs currently running and waiting in the queue
+func (s *Scheduler) Queue() QueueStatus {
+	running, pending := s.queue.snapshot()
+	if running == nil {
+		running = []Job{}
+	}
+	if pending == nil {
+		pending = []Job{}
+	}
+	return QueueStatus{Workers: s.workers, Running: running, Queued: pending}
+}
+
+// Enqueue queues a run of the named mapping and records it as a queued
+// task. The task ID is taken from the context trace ID when present.
+func (s *Scheduler) Enqueue(ctx context.Context, name, trigger string, opts RunOptions) (string, error) {
+	if s.queue.isClosed() {
+		return "", ErrShuttingDown
+	}
+	task, err := s.newQueuedTask(ctx, name, trigger, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := s.pushJob(task, trigger, opts); err != nil {
+		return "", err
+	}
+	return task.TaskID, nil
+}
+
+// newQueuedTask records a queued task for the named mapping with the
+// overrides of opts. The task ID is taken from the context trace ID when
+// present.
+func (s *Scheduler) newQueuedTask(ctx context.Context, name, trigger string, opts RunOptions) (*storage.Task, error) {
+	if _, err := s.db.GetMappingByName(name); err != nil {
+		return nil, fmt.Errorf("mapping not found: %s", name)
+	}
+
+	taskID, _ := ctx.Value(contextkeys.TraceIDKey).(string)
+	if taskID == "" {
+		taskID = uuid.New().String()
+	}
+
+	now := time.Now()
+	task := &storage.Task{
+		TaskID:       taskID,
+		ConfigName:   name,
+		Trigger:      trigger,
+		Type:         opts.TaskType,
+		ParentTaskID: opts.ParentTaskID,
+		Attempt:      opts.Attempt,
+		Status:       storage.TaskStatusQueued,
+		StartedAt:    now,
+
+		// Overrides of the run, so a task recovered before it started keeps them
+		Mode:         opts.Mode,
+		STRMMode:     opts.STRMMode,
+		Concurrent:   opts.Concurrent,
+		DryRun:       opts.DryRun,
+		Refresh:      opts.Refresh || len(opts.RefreshPaths) > 0,
+		RefreshPaths: strings.Join(opts.RefreshPaths, "\n"),
+		Subpaths:     strings.Join(opts.Subpaths, "\n"),
+	}
+	if err := s.db.CreateTask(task); err != nil {
+		return nil, fmt.Errorf("failed to create task: %w", err)
+	}
+	return task, nil
+}
+
+// pushJob queues a job for a task recorded as queued. Scheduled and webhook
+// runs are held back while their mapping is in a blackout window.
+func (s *Scheduler) pushJob(task *storage.Task, trigger string, opts RunOptions) error {
+	if until, ok := s.deferredUntil(task.ConfigName, trigger); ok {
+		if s.queue.isClosed() {
+			return ErrShuttingDown
+		}
+		s.deferJob(task, trigger, opts, until, "blackout window")
+		return nil
+	}
+
+	job := &Job{
+		TaskID:     task.TaskID,
+		Mapping:    task.ConfigName,
+		Trigger:    trigger,
+		Priority:   triggerPriority(trigger),
+		EnqueuedAt: time.Now(),
+		Opts:       opts,
+	}
+	if mapping, err := s.db.GetMappingByName(task.ConfigName); err == nil {
+		job.conflict = mapping.ConflictPolicy
+	}
+	job.ctx, job.cancel = context.WithCancelCause(context.WithValue(context.Background(), contextkeys.TraceIDKey, task.TaskID))
+	if err := s.queue.push(job); err != nil {
+		return err
+	}
+	log.Printf("[TraceID: %s] Task queued: mapping=%s, trigger=%s, resume=%v", task.TaskID[:8], task.ConfigName, trigger, opts.Resume)
+	return nil
+}
+
+// ResumeTask queues a failed, cancelled or interrupted task again under the
+// same task ID. The new attempt skips the directories finished before and
+// adds to the task's counters.
+func (s *Scheduler) ResumeTask(taskID string) error {
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil {
+		return ErrTaskNotFound
+	}
+	return s.resumeTask(task, TriggerManual)
+}
+
+// resumeTask queues task again with the given trigger's priority
+func (s *Scheduler) resumeTask(task *storage.Task, trigger string) error {
+	switch task.Status {
+	case storage.TaskStatusFailed, storage.TaskStatusCancelled, storage.TaskStatusInterrupted:
+	default:
+		return fmt.Errorf("%w: task is %s", ErrTaskNotResumable, task.Status)
+	}
+	if s.queue.isClosed() {
+		return ErrShuttingDown
+	}
+	if _, err := s.db.GetMappingByName(task.ConfigName); err != nil {
+		return fmt.Errorf("mapping not found: %s", task.ConfigName)
+	}
+
+	task.Status = storage.TaskStatusQueued
+	task.Errors = ""
+	task.CompletedAt = nil
+	if err := s.db.UpdateTask(task); err != nil {
+		return fmt.Errorf("failed to update task: %w", err)
+	}
+	opts := runOptionsFromTask(task)
+	opts.Resume = true
+	return s.pushJob(task, trigger, opts)
+}
+
+// EnqueueAll queues a run of every enabled mapping, each with its own task
+func (s *Scheduler) EnqueueAll(trigger string, opts RunOptions) ([]string, error) {
+	mappings, err := s.db.ListEnabledMappings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mappings: %w", err)
+	}
+
+	taskIDs := make([]string, 0, len(mappings))
+	for _, mapping := range mappings {
+		taskID, err := s.Enqueue(context.Background(), mapping.Name, trigger, opts)
+		if err != nil {
+			log.Printf("[Scheduler] Failed to queue mapping %s: %v", mapping.Name, err)
+			continue
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, nil
+}
+
+// startWorkers starts the queue workers
+func (s *Scheduler) startWorkers() {
+	for i := 0; i < s.workers; i++ {
+		s.workerWG.Add(1)
+		go func() {
+			defer s.workerWG.Done()
+			for job := s.queue.pop(); job != nil; job = s.queue.pop() {
+				s.runJob(job)
+				s.queue.done(job)
+			}
+		}()
+	}
+	log.Printf("[Scheduler] Started %d queue workers", s.workers)
+}
+
+// runJob runs a queued job with its task ID as trace ID, then queues the
+// follow-ups of its mapping that apply to the outcome and a retry when it
+// failed. A job that waited in the queue until its mapping entered a
+// blackout window is deferred again instead of run.
+func (s *Scheduler) runJob(job *Job) {
+	if job.dropped != "" {
+		if task, err := s.db.GetTaskByID(job.TaskID); err == nil {
+			s.recordDropped(task, job.TaskID[:8], job.dropped)
+		}
+		return
+	}
+	if until, ok := s.deferredUntil(job.Mapping, job.Trigger); ok {
+		if task, err := s.db.GetTaskByID(job.TaskID); err == nil && task.Status == storage.TaskStatusQueued {
+			job.cancel(nil)
+			s.deferJob(task, job.Trigger, job.Opts, until, "blackout window")
+			return
+		}
+	}
+	defer s.afterJob(job.TaskID)
+
+	if err := s.RunMappingByName(job.ctx, job.Mapping, job.Opts); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Printf("[Scheduler] Task %s (%s, %s) stopped: %v", job.TaskID[:8], job.Mapping, job.Trigger, context.Cause(job.ctx))
+			return
+		}
+		log.Printf("[Scheduler] Task %s (%s, %s) FAILED: %v", job.TaskID[:8], job.Mapping, job.Trigger, err)
+		// The mapping may have been deleted while the job was queued
+		if task, getErr := s.db.GetTaskByID(job.TaskID); getErr == nil && task.Status == storage.TaskStatusQueued {
+			s.finishUnstarted(task, job.TaskID[:8], storage.TaskStatusFailed, err.Error())
+		}
+	}
+}
+
+// afterJob queues a retry of a finished task or, when none is queued, the
+// follow-ups of its mapping, so a retried task starts its chain only once,
+// from its final attempt
+func (s *Scheduler) afterJob(taskID string) {
+	if !s.scheduleRetry(taskID) {
+		s.queueFollowUps(taskID)
+	}
+}
+
+// CancelTask cancels a queued or running task and returns its new status.
+// Queued tasks are removed from the queue and recorded as cancelled right
+// away; running tasks stop at the next cancellation point and keep the
+// counters of the files written so far.
+func (s *Scheduler) CancelTask(taskID string) (string, error) {
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil {
+		return "", ErrTaskNotFound
+	}
+	traceID := taskID[:min(8, len(taskID))]
+
+	if _, ok := s.cancelBatch(taskID); ok {
+		log.Printf("[TraceID: %s] Webhook batch cancelled via API", traceID)
+		s.finishUnstarted(task, traceID, storage.TaskStatusCancelled, ErrCancelled.Error())
+		return storage.TaskStatusCancelled, nil
+	}
+	if s.cancelDeferred(taskID) {
+		log.Printf("[TraceID: %s] Deferred task cancelled via API", traceID)
+		s.finishUnstarted(task, traceID, storage.TaskStatusCancelled, ErrCancelled.Error())
+		return storage.TaskStatusCancelled, nil
+	}
+
+	job, wasPending := s.queue.cancel(taskID, ErrCancelled)
+	if job == nil {
+		return task.Status, ErrTaskNotActive
+	}
+	if wasPending {
+		log.Printf("[TraceID: %s] Queued task cancelled via API", traceID)
+		s.finishUnstarted(task, traceID, storage.TaskStatusCancelled, ErrCancelled.Error())
+		return storage.TaskStatusCancelled, nil
+	}
+
+	log.Printf("[TraceID: %s] Cancelling running task via API", traceID)
+	return task.Status, nil
+}
@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestJobQueue_PriorityOrder(t *testing.T) {
+	q := newJobQueue()
+	for _, job := range []*Job{
+		{TaskID: "cron-1", Mapping: "a", Trigger: TriggerCron},
+		{TaskID: "webhook-1", Mapping: "b", Trigger: TriggerWebhook},
+		{TaskID: "cron-2", Mapping: "c", Trigger: TriggerCron},
+		{TaskID: "manual-1", Mapping: "d", Trigger: TriggerManual},
+		{TaskID: "webhook-2", Mapping: "e", Trigger: TriggerWebhook},
+	} {
+		job.Priority = triggerPriority(job.Trigger)
+		q.push(job)
+	}
+
+	want := []string{"manual-1", "webhook-1", "webhook-2", "cron-1", "cron-2"}
+	for i, id := range want {
+		job := q.pop()
+		if job == nil || job.TaskID != id {
+			t.Fatalf("pop %d: expected %s, got %+v", i, id, job)
+		}
+	}
+
+	running, pending := q.snapshot()
+	if len(running) != len(want) || len(pending) != 0 {
+		t.Fatalf("expected %d running and no pending jobs, got %d/%d", len(want), len(running), len(pending))
+	}
+
+	q.close()
+	if job := q.pop(); job != nil {
+		t.Fatalf("expected nil after close, got %+v", job)
+	}
+}
+
+func TestJobQueue_ParksJobsOfRunningMapping(t *testing.T) {
+	q := newJobQueue()
+	for _, job := range []*Job{
+		{TaskID: "movies-1", Mapping: "movies"},
+		{TaskID: "movies-2", Mapping: "movies"},
+		{TaskID: "movies-3", Mapping: "movies"},
+		{TaskID: "anime-1", Mapping: "anime"},
+		{TaskID: "music-1", Mapping: "music", conflict: ConflictSkip},
+		{TaskID: "music-2", Mapping: "music", conflict: ConflictSkip},
+	} {
+		job.cancel = func(error) {}
+		q.push(job)
+	}
+
+	// movies-2 waits for movies-1 without holding a worker; movies-3 is
+	// taken to be dropped and skip-policy jobs are taken to be skipped
+	var got []string
+	for i := 0; i < 5; i++ {
+		job := q.pop()
+		got = append(got, job.TaskID+":"+job.dropped)
+	}
+	want := "[movies-1: movies-3:task movies-2 is already queued for mapping movies anime-1: music-1: music-2:]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("popped %v, want %s", got, want)
+	}
+
+	_, pending := q.snapshot()
+	if len(pending) != 1 || pending[0].TaskID != "movies-2" {
+		t.Fatalf("expected movies-2 to wait, got %+v", pending)
+	}
+	// Workers finish dropped jobs right away
+	q.done(q.running["movies-3"])
+	q.done(q.running["movies-1"])
+	if job := q.pop(); job.TaskID != "movies-2" || job.dropped != "" {
+		t.Fatalf("expected movies-2 once movies-1 is done, got %+v", job)
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	s := newTestScheduler(t)
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", Source: "/media", Target: "/strm"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	runningID, err := s.Enqueue(context.Background(), "movies", TriggerCron, RunOptions{})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	queuedID, _ := s.Enqueue(context.Background(), "movies", TriggerCron, RunOptions{})
+	running := s.queue.pop()
+
+	// A queued task is removed and recorded right away
+	status, err := s.CancelTask(queuedID)
+	if err != nil || status != storage.TaskStatusCancelled {
+		t.Fatalf("expected cancelled, got %q, %v", status, err)
+	}
+	if task, _ := s.db.GetTaskByID(queuedID); task.Status != storage.TaskStatusCancelled {
+		t.Fatalf("expected cancelled task record, got %s", task.Status)
+	}
+	if _, pending := s.queue.snapshot(); len(pending) != 0 {
+		t.Fatalf("expected empty queue, got %d jobs", len(pending))
+	}
+
+	// A running task is signalled through its context
+	if _, err := s.CancelTask(runningID); err != nil {
+		t.Fatalf("CancelTask failed: %v", err)
+	}
+	if !errors.Is(context.Cause(running.ctx), ErrCancelled) {
+		t.Fatalf("expected ErrCancelled cause, got %v", context.Cause(running.ctx))
+	}
+
+	if _, err := s.CancelTask(queuedID); !errors.Is(err, ErrTaskNotActive) {
+		t.Fatalf("expected ErrTaskNotActive, got %v", err)
+	}
+	if _, err := s.CancelTask("missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+}
+
+func TestRunOptionsFromTask_KeepsRefresh(t *testing.T) {
+	s := newTestScheduler(t)
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", Source: "/media", Target: "/strm"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+
+	for _, opts := range []RunOptions{
+		{Mode: "full", Refresh: true},
+		{Subpaths: []string{"/media/a"}, RefreshPaths: []string{"/media/a", "/media/b"}},
+	} {
+		task, err := s.newQueuedTask(context.Background(), "movies", TriggerManual, opts)
+		if err != nil {
+			t.Fatalf("newQueuedTask failed: %v", err)
+		}
+		stored, _ := s.db.GetTaskByID(task.TaskID)
+		got := runOptionsFromTask(stored)
+		if fmt.Sprint(got.Mode, got.Refresh, got.Subpaths, got.RefreshPaths) != fmt.Sprint(opts.Mode, opts.Refresh, opts.Subpaths, opts.RefreshPaths) {
+			t.Errorf("runOptionsFromTask = %+v, want the options of %+v", got, opts)
+		}
+	}
+}
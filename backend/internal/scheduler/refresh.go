@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"path"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+	"github.com/konghanghang/openlist-strm/internal/config"
+)
+
+// Refresh policies of a mapping
+const (
+	RefreshNever   = "never"   // always use Alist's cached listings
+	RefreshTop     = "top"     // refresh the mapping source directory only
+	RefreshSubpath = "subpath" // refresh the directories on and below RefreshPath
+	RefreshAlways  = "always"  // refresh every directory
+)
+
+// ValidRefreshPolicy reports whether policy is a known refresh policy
+func ValidRefreshPolicy(policy string) bool {
+	switch policy {
+	case RefreshNever, RefreshTop, RefreshSubpath, RefreshAlways:
+		return true
+	}
+	return false
+}
+
+// refreshSelector builds the predicate selecting directories whose listing
+// must bypass Alist's cache, combining the mapping policy with the paths of
+// this run (e.g. from a webhook). It returns nil when nothing is refreshed.
+func refreshSelector(mapping config.MappingConfig, runPaths []string) func(dir string) bool {
+	var paths []string
+	refreshAll := false
+	refreshTop := false
+
+	switch mapping.RefreshPolicy {
+	case RefreshAlways:
+		refreshAll = true
+	case RefreshTop:
+		refreshTop = true
+	case RefreshSubpath:
+		if mapping.RefreshPath != "" {
+			paths = append(paths, resolveSourcePath(mapping.Source, mapping.RefreshPath))
+		}
+	}
+	paths = append(paths, runPaths...)
+
+	if !refreshAll && !refreshTop && len(paths) == 0 {
+		return nil
+	}
+
+	source := path.Clean(mapping.Source)
+	return func(dir string) bool {
+		if refreshAll {
+			return true
+		}
+		dir = path.Clean(dir)
+		if refreshTop && dir == source {
+			return true
+		}
+		for _, p := range paths {
+			// Refresh the directories leading to p (a new entry must become
+			// visible in each parent) and everything below it
+			if alist.IsWithin(dir, p) || alist.IsWithin(p, dir) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// resolveSourcePath turns a path relative to the mapping source into an Alist path
+func resolveSourcePath(source, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(source, p)
+}
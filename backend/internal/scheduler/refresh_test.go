@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+)
+
+func TestRefreshSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		subpath  string
+		runPaths []string
+		dir      string
+		want     bool
+	}{
+		{name: "never", policy: RefreshNever, dir: "/media", want: false},
+		{name: "always", policy: RefreshAlways, dir: "/media/a/b", want: true},
+		{name: "top refreshes source", policy: RefreshTop, dir: "/media", want: true},
+		{name: "top skips children", policy: RefreshTop, dir: "/media/a", want: false},
+		{name: "subpath itself", policy: RefreshSubpath, subpath: "new", dir: "/media/new", want: true},
+		{name: "subpath descendant", policy: RefreshSubpath, subpath: "new", dir: "/media/new/x", want: true},
+		{name: "subpath parent", policy: RefreshSubpath, subpath: "new/season", dir: "/media/new", want: true},
+		{name: "subpath sibling", policy: RefreshSubpath, subpath: "new", dir: "/media/old", want: false},
+		{name: "subpath prefix boundary", policy: RefreshSubpath, subpath: "new", dir: "/media/newer", want: false},
+		{name: "webhook file refreshes parents", policy: RefreshNever, runPaths: []string{"/media/show/s01/e01.mkv"}, dir: "/media/show/s01", want: true},
+		{name: "webhook file skips siblings", policy: RefreshNever, runPaths: []string{"/media/show/s01/e01.mkv"}, dir: "/media/show/s02", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := config.MappingConfig{Source: "/media", RefreshPolicy: tt.policy, RefreshPath: tt.subpath}
+			selector := refreshSelector(mapping, tt.runPaths)
+
+			got := selector != nil && selector(tt.dir)
+			if got != tt.want {
+				t.Errorf("refresh(%s) = %v, want %v", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
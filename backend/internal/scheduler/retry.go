@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// maxRetryBackoff bounds the delay before a retry
+const maxRetryBackoff = 24 * time.Hour
+
+// retryBackoff returns the delay before retry attempt (1 for the first
+// retry): backoff seconds, doubled for each earlier retry
+func retryBackoff(backoff, attempt int) time.Duration {
+	delay := time.Duration(max(backoff, 0)) * time.Second
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// scheduleRetry queues a retry of a finished generation task when its
+// mapping has a retry policy: a failed task is run again with the same
+// settings, and a completed task with failed files gets a run limited to
+// those files. Webhook runs that failed are retried by the webhook inbox
+// instead. It reports whether a retry was queued.
+func (s *Scheduler) scheduleRetry(taskID string) bool {
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil || task.DryRun || task.Type != "" || task.Event != "" {
+		return false
+	}
+	traceID := taskID[:min(8, len(taskID))]
+	mapping, err := s.db.GetMappingByName(task.ConfigName)
+	if err != nil || mapping.RetryMaxAttempts <= 0 {
+		return false
+	}
+
+	var opts RunOptions
+	switch {
+	case task.Status == storage.TaskStatusFailed && task.Trigger != TriggerWebhook:
+		opts = runOptionsFromTask(task)
+		// The retry starts over under its own task ID
+		if err := s.db.DeleteTaskCheckpoints(task.TaskID); err != nil {
+			log.Printf("[TraceID: %s] WARNING: Failed to delete checkpoints: %v", traceID, err)
+		}
+	case task.Status == storage.TaskStatusCompleted && task.FailedPaths != "":
+		// Only the files that failed; incremental so nothing else is cleaned
+		opts = RunOptions{
+			Mode:       "incremental",
+			STRMMode:   task.STRMMode,
+			Concurrent: task.Concurrent,
+			Subpaths:   splitSubpaths(task.FailedPaths),
+		}
+	default:
+		return false
+	}
+	if task.Attempt >= mapping.RetryMaxAttempts {
+		log.Printf("[TraceID: %s] Retry of mapping %s not queued: %d of %d attempts used",
+			traceID, task.ConfigName, task.Attempt, mapping.RetryMaxAttempts)
+		return false
+	}
+	if s.queue.isClosed() {
+		return false
+	}
+	opts.ParentTaskID = task.TaskID
+	opts.Attempt = task.Attempt + 1
+
+	retry, err := s.newQueuedTask(context.Background(), task.ConfigName, TriggerRetry, opts)
+	if err != nil {
+		log.Printf("[TraceID: %s] Retry of mapping %s FAILED to queue: %v", traceID, task.ConfigName, err)
+		return false
+	}
+	log.Printf("[TraceID: %s] Retry %d/%d of mapping %s QUEUED: task=%s",
+		traceID, opts.Attempt, mapping.RetryMaxAttempts, task.ConfigName, retry.TaskID)
+	s.deferJob(retry, TriggerRetry, opts, time.Now().Add(retryBackoff(mapping.RetryBackoff, opts.Attempt)), "retry backoff")
+	return true
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	var got []time.Duration
+	for attempt := 1; attempt <= 4; attempt++ {
+		got = append(got, retryBackoff(60, attempt))
+	}
+	if want := "[1m0s 2m0s 4m0s 8m0s]"; fmt.Sprint(got) != want {
+		t.Errorf("retryBackoff = %v, want %s", got, want)
+	}
+	if got := retryBackoff(3600, 20); got != maxRetryBackoff {
+		t.Errorf("retryBackoff(3600, 20) = %v, want %v", got, maxRetryBackoff)
+	}
+}
+
+func TestScheduleRetry(t *testing.T) {
+	s := newTestScheduler(t)
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", RetryMaxAttempts: 2, RetryBackoff: 3600}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+	// finish records a finished task and returns its deferred retry as
+	// "trigger:attempt:mode:subpaths", or "none"
+	finish := func(task *storage.Task) string {
+		task.ConfigName = "movies"
+		task.StartedAt = time.Now()
+		if err := s.db.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		s.scheduleRetry(task.TaskID)
+		for taskID, job := range s.deferred {
+			if job.task.ParentTaskID == task.TaskID {
+				s.cancelDeferred(taskID)
+				return fmt.Sprintf("%s:%d:%s:%v", job.task.Trigger, job.task.Attempt, job.opts.Mode, job.opts.Subpaths)
+			}
+		}
+		return "none"
+	}
+
+	got := finish(&storage.Task{TaskID: "failed", Mode: "full", Subpaths: "/movies/a", Status: storage.TaskStatusFailed})
+	if want := "retry:1:full:[/movies/a]"; got != want {
+		t.Errorf("retry of failed task = %s, want %s", got, want)
+	}
+
+	got = finish(&storage.Task{TaskID: "partial", Mode: "full", Status: storage.TaskStatusCompleted,
+		FailedPaths: "/movies/a.mkv\n/movies/b.mkv", Attempt: 1})
+	if want := "retry:2:incremental:[/movies/a.mkv /movies/b.mkv]"; got != want {
+		t.Errorf("retry of failed files = %s, want %s", got, want)
+	}
+
+	for _, task := range []*storage.Task{
+		{TaskID: "exhausted", Status: storage.TaskStatusFailed, Attempt: 2},
+		{TaskID: "webhook", Trigger: TriggerWebhook, Status: storage.TaskStatusFailed},
+		{TaskID: "clean", Status: storage.TaskStatusCompleted},
+		{TaskID: "cancelled", Status: storage.TaskStatusCancelled},
+		{TaskID: "dry", DryRun: true, Status: storage.TaskStatusFailed},
+	} {
+		if got := finish(task); got != "none" {
+			t.Errorf("task %s should not be retried, got %s", task.TaskID, got)
+		}
+	}
+}
+
+func TestAfterJob_FollowUpsFromFinalAttempt(t *testing.T) {
+	s := newTestScheduler(t)
+	mappings := []*storage.Mapping{
+		{Name: "movies", RetryMaxAttempts: 1, RetryBackoff: 3600, FollowUps: `[{"mapping":"library"}]`},
+		{Name: "library"},
+	}
+	for _, m := range mappings {
+		if err := s.db.CreateMapping(m); err != nil {
+			t.Fatalf("failed to create mapping: %v", err)
+		}
+	}
+	finish := func(task *storage.Task) (retries, followUps int) {
+		task.ConfigName = "movies"
+		task.Mode = "full"
+		task.Status = storage.TaskStatusFailed
+		task.StartedAt = time.Now()
+		if err := s.db.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		s.afterJob(task.TaskID)
+		for taskID := range s.deferred {
+			s.cancelDeferred(taskID)
+			retries++
+		}
+		_, pending := s.queue.snapshot()
+		for _, job := range pending {
+			s.queue.cancel(job.TaskID, ErrCancelled)
+			followUps++
+		}
+		return retries, followUps
+	}
+
+	// The failed first attempt is retried; its follow-up waits for the retry
+	if retries, followUps := finish(&storage.Task{TaskID: "first"}); retries != 1 || followUps != 0 {
+		t.Errorf("first attempt: %d retries, %d follow-ups; want 1 retry, no follow-up", retries, followUps)
+	}
+	// The final attempt starts the chain once
+	if retries, followUps := finish(&storage.Task{TaskID: "final", Attempt: 1, ParentTaskID: "first"}); retries != 0 || followUps != 1 {
+		t.Errorf("final attempt: %d retries, %d follow-ups; want no retry, 1 follow-up", retries, followUps)
+	}
+}
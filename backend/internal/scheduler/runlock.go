@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// Conflict policies for a trigger that arrives while its mapping is running
+const (
+	ConflictSkip   = "skip"   // drop the new trigger
+	ConflictQueue  = "queue"  // run once more after the current run; extra triggers are dropped
+	ConflictCancel = "cancel" // cancel the current run and start the new one
+)
+
+// ValidConflictPolicy reports whether policy is a known conflict policy
+func ValidConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictSkip, ConflictQueue, ConflictCancel:
+		return true
+	}
+	return false
+}
+
+// mappingRun tracks the run currently holding a mapping's lock
+type mappingRun struct {
+	taskID   string
+	cancel   context.CancelCauseFunc
+	done     chan struct{} // closed when the run releases the lock
+	followUp string        // task ID waiting to run next (queue policy)
+}
+
+// acquireRun takes the per-mapping lock for task, applying the mapping's
+// conflict policy while another run holds it. It returns the context for
+// the run and a release func; ok is false when the trigger was dropped, in
+// which case the task has already been recorded.
+func (s *Scheduler) acquireRun(ctx context.Context, mapping config.MappingConfig, task *storage.Task, traceID string) (runCtx context.Context, release func(), ok bool) {
+	policy := mapping.ConflictPolicy
+	if !ValidConflictPolicy(policy) {
+		policy = ConflictQueue
+	}
+
+	for {
+		s.runMu.Lock()
+		current, busy := s.runs[mapping.Name]
+		if !busy {
+			runCtx, cancel := context.WithCancelCause(ctx)
+			run := &mappingRun{taskID: task.TaskID, cancel: cancel, done: make(chan struct{})}
+			s.runs[mapping.Name] = run
+			s.runMu.Unlock()
+
+			release := func() {
+				s.runMu.Lock()
+				delete(s.runs, mapping.Name)
+				s.runMu.Unlock()
+				cancel(nil)
+				close(run.done)
+			}
+			return runCtx, release, true
+		}
+
+		switch policy {
+		case ConflictCancel:
+			log.Printf("[TraceID: %s] Mapping %s is running (task %s), cancelling it", traceID, mapping.Name, current.taskID)
+			current.cancel(fmt.Errorf("cancelled by newer task %s", task.TaskID))
+		case ConflictQueue:
+			if current.followUp != "" && current.followUp != task.TaskID {
+				followUp := current.followUp
+				s.runMu.Unlock()
+				s.recordDropped(task, traceID, fmt.Sprintf("task %s is already queued for mapping %s", followUp, mapping.Name))
+				return nil, nil, false
+			}
+			current.followUp = task.TaskID
+		default:
+			runningID := current.taskID
+			s.runMu.Unlock()
+			s.recordDropped(task, traceID, fmt.Sprintf("mapping %s is already running (task %s)", mapping.Name, runningID))
+			return nil, nil, false
+		}
+		done := current.done
+		s.runMu.Unlock()
+
+		if policy == ConflictQueue {
+			log.Printf("[TraceID: %s] Mapping %s is running (task %s), waiting as follow-up", traceID, mapping.Name, current.taskID)
+			if task.ID == 0 {
+				task.Status = storage.TaskStatusQueued
+				if err := s.db.CreateTask(task); err != nil {
+					log.Printf("[TraceID: %s] WARNING: Failed to record queued task: %v", traceID, err)
+				}
+			}
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.runMu.Lock()
+			if current.followUp == task.TaskID {
+				current.followUp = ""
+			}
+			s.runMu.Unlock()
+			if errors.Is(context.Cause(ctx), errShutdown) {
+				// Stays queued and is recovered on the next start
+				return nil, nil, false
+			}
+			s.finishUnstarted(task, traceID, storage.TaskStatusCancelled, context.Cause(ctx).Error())
+			return nil, nil, false
+		}
+	}
+}
+
+// recordDropped records a trigger that was dropped because of a conflict
+func (s *Scheduler) recordDropped(task *storage.Task, traceID, reason string) {
+	log.Printf("[TraceID: %s] Task SKIPPED: %s", traceID, reason)
+	s.finishUnstarted(task, traceID, storage.TaskStatusSkipped, reason)
+}
+
+// finishUnstarted stores the final state of a task that never ran
+func (s *Scheduler) finishUnstarted(task *storage.Task, traceID, status, reason string) {
+	now := time.Now()
+	task.Status = status
+	task.Errors = reason
+	task.CompletedAt = &now
+
+	var err error
+	if task.ID == 0 {
+		err = s.db.CreateTask(task)
+	} else {
+		err = s.db.UpdateTask(task)
+	}
+	if err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to record %s task: %v", traceID, status, err)
+	}
+}
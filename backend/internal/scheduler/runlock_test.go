@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/config"
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func newTestScheduler(t *testing.T) *Scheduler {
+	t.Helper()
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Scheduler{cfg: &config.Config{}, db: db, runs: make(map[string]*mappingRun), queue: newJobQueue()}
+}
+
+func TestAcquireRun_Policies(t *testing.T) {
+	s := newTestScheduler(t)
+	mapping := config.MappingConfig{Name: "movies", ConflictPolicy: ConflictSkip}
+
+	first := &storage.Task{TaskID: "first", ConfigName: "movies", StartedAt: time.Now()}
+	firstCtx, release, ok := s.acquireRun(context.Background(), mapping, first, "first")
+	if !ok {
+		t.Fatal("first run should acquire the lock")
+	}
+
+	// skip: the second trigger is dropped and recorded
+	skipped := &storage.Task{TaskID: "skipped", ConfigName: "movies", StartedAt: time.Now()}
+	if _, _, ok := s.acquireRun(context.Background(), mapping, skipped, "skipped"); ok {
+		t.Fatal("skip policy should drop the trigger")
+	}
+	if got, _ := s.db.GetTaskByID("skipped"); got == nil || got.Status != storage.TaskStatusSkipped {
+		t.Fatalf("expected skipped task record, got %+v", got)
+	}
+
+	// queue: one follow-up waits, further triggers are dropped
+	mapping.ConflictPolicy = ConflictQueue
+	type holder struct {
+		ctx     context.Context
+		release func()
+	}
+	acquired := make(chan holder, 1)
+	go func() {
+		queued := &storage.Task{TaskID: "queued", ConfigName: "movies", StartedAt: time.Now()}
+		if ctx, rel, ok := s.acquireRun(context.Background(), mapping, queued, "queued"); ok {
+			acquired <- holder{ctx, rel}
+		}
+		close(acquired)
+	}()
+	waitFor(t, func() bool {
+		got, _ := s.db.GetTaskByID("queued")
+		return got != nil && got.Status == storage.TaskStatusQueued
+	})
+	extra := &storage.Task{TaskID: "extra", ConfigName: "movies", StartedAt: time.Now()}
+	if _, _, ok := s.acquireRun(context.Background(), mapping, extra, "extra"); ok {
+		t.Fatal("second follow-up should be dropped")
+	}
+
+	release()
+	if firstCtx.Err() == nil {
+		t.Fatal("released run context should be done")
+	}
+	queuedRun, ok := <-acquired
+	if !ok {
+		t.Fatal("queued run should acquire the lock after release")
+	}
+
+	// cancel: the running run is cancelled with a cause, then replaced
+	mapping.ConflictPolicy = ConflictCancel
+	started := make(chan error, 1)
+	go func() {
+		newer := &storage.Task{TaskID: "newer", ConfigName: "movies", StartedAt: time.Now()}
+		ctx, rel, ok := s.acquireRun(context.Background(), mapping, newer, "newer")
+		if !ok {
+			started <- context.Canceled
+			return
+		}
+		defer rel()
+		started <- ctx.Err()
+	}()
+	<-queuedRun.ctx.Done()
+	if cause := context.Cause(queuedRun.ctx); cause == nil || cause == context.Canceled {
+		t.Fatalf("expected a cancellation cause, got %v", cause)
+	}
+	queuedRun.release()
+	if err := <-started; err != nil {
+		t.Fatal("newer run should start with a live context")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
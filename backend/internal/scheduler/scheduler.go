@@ -2,8 +2,10 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -15,10 +17,122 @@ import (
 	"github.com/konghanghang/openlist-strm/internal/config"
 	"github.com/konghanghang/openlist-strm/internal/contextkeys"
 	"github.com/konghanghang/openlist-strm/internal/notification"
+	"github.com/konghanghang/openlist-strm/internal/secrets"
 	"github.com/konghanghang/openlist-strm/internal/storage"
 	"github.com/konghanghang/openlist-strm/internal/strm"
 )
 
+// progressInterval is the minimum interval between task progress writes
+const progressInterval = 2 * time.Second
+
+// RunOptions holds per-run settings that are not part of the mapping
+type RunOptions struct {
+	// RefreshPaths are Alist paths whose directory listings (and those of
+	// their parents within the source) bypass Alist's cache for this run
+	RefreshPaths []string
+
+	// Resume continues an earlier attempt of the same task: directories it
+	// finished are skipped, its counters are carried over and the target is
+	// never cleaned, even in full mode
+	Resume bool
+
+	// Subpaths limits the run to these directories or files within the
+	// mapping source (Alist paths, absolute or relative to the source)
+	Subpaths []string
+
+	// Event is EventDelete or EventMove for file events reported by a
+	// webhook: the single subpath was deleted, or moved there from MovedFrom
+	Event     string
+	MovedFrom string
+
+	// TaskType is TaskTypeValidate for validation tasks; ParentTaskID is the
+	// task whose completion queued this run
+	TaskType     string
+	ParentTaskID string
+
+	// Attempt numbers the retries of a failed task, 0 for the first run
+	Attempt int
+
+	// Overrides of the mapping settings for this run; zero values keep the
+	// mapping's own settings
+	Mode       string // incremental or full
+	STRMMode   string // alist_path or http_url
+	Concurrent int
+	DryRun     bool // report what would change without writing anything
+	Refresh    bool // bypass Alist's cache for every listing
+}
+
+// apply returns mapping with the run's overrides applied
+func (o RunOptions) apply(mapping config.MappingConfig) config.MappingConfig {
+	if o.Mode != "" {
+		mapping.Mode = o.Mode
+	}
+	if o.STRMMode != "" {
+		mapping.STRMMode = o.STRMMode
+	}
+	if o.Concurrent > 0 {
+		mapping.Concurrent = o.Concurrent
+	}
+	if o.Refresh {
+		mapping.RefreshPolicy = RefreshAlways
+	}
+	return mapping
+}
+
+// runOptionsFromTask rebuilds the overrides recorded on a task so that a
+// resumed attempt runs with the same settings
+func runOptionsFromTask(task *storage.Task) RunOptions {
+	return RunOptions{
+		Mode:       task.Mode,
+		STRMMode:   task.STRMMode,
+		Concurrent: task.Concurrent,
+		DryRun:     task.DryRun,
+		Subpaths:   splitSubpaths(task.Subpaths),
+
+		// Refresh is also recorded for runs with refresh paths only
+		Refresh:      task.Refresh && task.RefreshPaths == "",
+		RefreshPaths: splitSubpaths(task.RefreshPaths),
+
+		TaskType:     task.Type,
+		ParentTaskID: task.ParentTaskID,
+		Attempt:      task.Attempt,
+	}
+}
+
+// scopeSubpaths resolves subpaths against the mapping source and drops the
+// ones outside of it. ok is false when none is left; a subpath covering the
+// whole source returns no subpaths and ok.
+func scopeSubpaths(source string, subpaths []string, traceID string) (scoped []string, ok bool) {
+	if len(subpaths) == 0 {
+		return nil, true
+	}
+	for _, p := range subpaths {
+		p = resolveSourcePath(source, p)
+		if !alist.IsWithin(p, source) {
+			log.Printf("[TraceID: %s] WARNING: Subpath %s is outside source %s, ignoring", traceID, p, source)
+			continue
+		}
+		if path.Clean(p) == path.Clean(source) {
+			return nil, true
+		}
+		scoped = append(scoped, p)
+	}
+	return scoped, len(scoped) > 0
+}
+
+// splitSubpaths parses the subpaths recorded on a task
+func splitSubpaths(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// CronParser parses the cron expressions of mappings for the cron scheduler,
+// catch-up and validation alike: six fields with seconds, or descriptors
+// such as @daily and @every 1h
+var CronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 // Scheduler manages task scheduling and execution
 type Scheduler struct {
 	cfg         *config.Config
@@ -29,23 +143,62 @@ type Scheduler struct {
 	cronJobs    map[uint]cron.EntryID // mapping ID -> cron entry ID
 	mu          sync.RWMutex          // protect cronJobs map
 	notifier    *notification.MediaServerNotifier
+
+	folderPasswords *folderPasswords
+
+	runMu sync.Mutex             // protects runs
+	runs  map[string]*mappingRun // mapping name -> run holding its lock
+
+	queue    *jobQueue
+	workers  int
+	workerWG sync.WaitGroup
+
+	debounceWindow time.Duration            // webhook triggers within it share a run
+	batchMu        sync.Mutex               // protects batches
+	batches        map[string]*webhookBatch // batch key -> open webhook batch
+
+	deferMu  sync.Mutex              // protects deferred
+	deferred map[string]*deferredJob // task ID -> run held back by a blackout window or until its retry is due
 }
 
 // New creates a new scheduler
-func New(cfg *config.Config, alistClient *alist.Client, generator *strm.Generator, db *storage.DB) *Scheduler {
-	return &Scheduler{
-		cfg:         cfg,
-		alistClient: alistClient,
-		generator:   generator,
-		db:          db,
-		cron:        cron.New(cron.WithSeconds()), // Support second-level cron expressions
-		cronJobs:    make(map[uint]cron.EntryID),
-		notifier:    notification.NewMediaServerNotifier(&cfg.MediaServer),
+func New(cfg *config.Config, alistClient *alist.Client, generator *strm.Generator, db *storage.DB, box *secrets.Box) *Scheduler {
+	s := &Scheduler{
+		cfg:             cfg,
+		alistClient:     alistClient,
+		generator:       generator,
+		db:              db,
+		cron:            cron.New(cron.WithParser(CronParser)),
+		cronJobs:        make(map[uint]cron.EntryID),
+		notifier:        notification.NewMediaServerNotifier(&cfg.MediaServer),
+		folderPasswords: newFolderPasswords(db, box),
+		runs:            make(map[string]*mappingRun),
+		queue:           newJobQueue(),
+		workers:         cfg.Scheduler.Workers,
+		debounceWindow:  cfg.Webhook.DebounceWindow * time.Second,
+		batches:         make(map[string]*webhookBatch),
+	}
+	if s.workers <= 0 {
+		s.workers = defaultWorkers
 	}
+
+	// Pass folder passwords on list/get requests for protected paths
+	alistClient.SetPasswordResolver(s.folderPasswords.Resolve)
+
+	return s
+}
+
+// ReloadFolderPasswords reloads folder passwords after they changed
+func (s *Scheduler) ReloadFolderPasswords() error {
+	return s.folderPasswords.Reload()
 }
 
 // Start starts the scheduler
 func (s *Scheduler) Start() error {
+	if err := s.folderPasswords.Reload(); err != nil {
+		log.Printf("[Scheduler] WARNING: Failed to load folder passwords: %v", err)
+	}
+
 	// Load all mappings with cron expressions and register them
 	mappings, err := s.db.ListMappings()
 	if err != nil {
@@ -60,7 +213,7 @@ func (s *Scheduler) Start() error {
 			mapping.Name, mapping.Enabled, mapping.CronExpr)
 
 		if mapping.Enabled && mapping.CronExpr != "" {
-			if err := s.AddCronJob(mapping.ID, mapping.Name, mapping.CronExpr); err != nil {
+			if err := s.AddCronJob(mapping.ID, mapping.Name, mapping.CronExpr, mapping.Timezone); err != nil {
 				log.Printf("[Scheduler] ERROR: Failed to add cron job for mapping %s: %v", mapping.Name, err)
 			} else {
 				registeredCount++
@@ -74,6 +227,10 @@ func (s *Scheduler) Start() error {
 		}
 	}
 
+	s.recoverTasks()
+	s.startWorkers()
+	s.runOnStartup(mappings)
+	s.catchUpMissedRuns(mappings)
 	s.cron.Start()
 	log.Printf("[Scheduler] Scheduler started successfully with %d cron jobs registered", registeredCount)
 
@@ -100,8 +257,9 @@ func (s *Scheduler) Start() error {
 func (s *Scheduler) Stop() {
 	if s.cron != nil {
 		s.cron.Stop()
-		log.Println("Scheduler stopped")
 	}
+	s.queue.close()
+	log.Println("Scheduler stopped")
 }
 
 // RunAll runs all enabled mappings (from database)
@@ -112,24 +270,7 @@ func (s *Scheduler) RunAll(ctx context.Context) error {
 	}
 
 	for _, mapping := range mappings {
-		// Parse extensions from database (comma-separated string)
-		extensions := strings.Split(mapping.Extensions, ",")
-		for i := range extensions {
-			extensions[i] = strings.TrimSpace(extensions[i])
-		}
-
-		mappingConfig := config.MappingConfig{
-			Name:       mapping.Name,
-			Source:     mapping.Source,
-			Target:     mapping.Target,
-			Extensions: extensions,
-			Concurrent: mapping.Concurrent,
-			Mode:       mapping.Mode,
-			STRMMode:   mapping.STRMMode,
-			Enabled:    mapping.Enabled,
-		}
-
-		if err := s.RunMapping(ctx, mappingConfig); err != nil {
+		if err := s.RunMapping(ctx, mappingConfigFromModel(mapping), RunOptions{}); err != nil {
 			log.Printf("Failed to run mapping %s: %v", mapping.Name, err)
 		}
 	}
@@ -137,7 +278,7 @@ func (s *Scheduler) RunAll(ctx context.Context) error {
 }
 
 // RunMapping runs a single mapping
-func (s *Scheduler) RunMapping(ctx context.Context, mapping config.MappingConfig) error {
+func (s *Scheduler) RunMapping(ctx context.Context, mapping config.MappingConfig, opts RunOptions) error {
 	// Get trace ID from context or generate new one
 	// Get or generate task ID from context
 	var taskID string
@@ -150,71 +291,290 @@ func (s *Scheduler) RunMapping(ctx context.Context, mapping config.MappingConfig
 	}
 	traceID := taskID[:8] // Use first 8 chars as short trace ID
 
-	// Create task record
-	task := &storage.Task{
-		TaskID:     taskID,
-		ConfigName: mapping.Name,
-		Mode:       mapping.Mode,
-		Status:     "running",
-		StartedAt:  time.Now(),
+	// Queued runs already have a task record
+	task, err := s.db.GetTaskByID(taskID)
+	if err != nil || task.Status != storage.TaskStatusQueued {
+		task = &storage.Task{
+			TaskID:     taskID,
+			ConfigName: mapping.Name,
+			StartedAt:  time.Now(),
+		}
 	}
-	if err := s.db.CreateTask(task); err != nil {
-		return fmt.Errorf("[TraceID: %s] failed to create task: %w", traceID, err)
+	mapping = opts.apply(mapping)
+	task.Mode = mapping.Mode
+	task.STRMMode = mapping.STRMMode
+	task.Concurrent = mapping.Concurrent
+	task.DryRun = opts.DryRun
+	task.Refresh = opts.Refresh || len(opts.RefreshPaths) > 0
+	task.RefreshPaths = strings.Join(opts.RefreshPaths, "\n")
+	subpaths, ok := scopeSubpaths(mapping.Source, opts.Subpaths, traceID)
+	if !ok {
+		// Every subpath was outside the source; running the whole mapping
+		// instead would be far more than was asked for
+		s.finishUnstarted(task, traceID, storage.TaskStatusSkipped, "no subpath within the mapping source")
+		return nil
 	}
+	task.Subpaths = strings.Join(subpaths, "\n")
+	task.Event = opts.Event
+	task.Type = opts.TaskType
+	task.ParentTaskID = opts.ParentTaskID
+	task.Attempt = opts.Attempt
+
+	// Only one run per mapping at a time; conflicting triggers follow the
+	// mapping's conflict policy and may be dropped
+	runCtx, release, ok := s.acquireRun(ctx, mapping, task, traceID)
+	if !ok {
+		return nil
+	}
+	defer release()
+	ctx = runCtx
 
-	log.Printf("[TraceID: %s] Task started: mapping=%s, mode=%s, source=%s, target=%s",
-		traceID, mapping.Name, mapping.Mode, mapping.Source, mapping.Target)
+	// Counters of earlier attempts when resuming
+	var base strm.GenerateResult
+	if opts.Resume {
+		base = strm.GenerateResult{FilesCreated: task.FilesCreated, FilesDeleted: task.FilesDeleted, FilesSkipped: task.FilesSkipped}
+	}
 
-	// Generate STRM files (context now contains trace_id)
-	result, err := s.generator.Generate(ctx, strm.GenerateOptions{
+	// Create or update task record
+	task.Status = storage.TaskStatusRunning
+	task.StartedAt = time.Now()
+	if task.ID == 0 {
+		if err := s.db.CreateTask(task); err != nil {
+			return fmt.Errorf("[TraceID: %s] failed to create task: %w", traceID, err)
+		}
+	} else if err := s.db.UpdateTask(task); err != nil {
+		return fmt.Errorf("[TraceID: %s] failed to update task: %w", traceID, err)
+	}
+
+	log.Printf("[TraceID: %s] Task started: mapping=%s, mode=%s, strm_mode=%s, concurrent=%d, dry_run=%v, source=%s, target=%s",
+		traceID, mapping.Name, mapping.Mode, mapping.STRMMode, mapping.Concurrent, opts.DryRun, mapping.Source, mapping.Target)
+	if len(subpaths) > 0 {
+		log.Printf("[TraceID: %s] Run limited to subpaths: %v", traceID, subpaths)
+	}
+
+	if opts.TaskType == TaskTypeValidate {
+		return s.runValidate(ctx, task, mapping, traceID)
+	}
+
+	// File events: a deleted path only needs its targets removed; a moved
+	// path has its sidecars relocated before the new path is generated
+	genOpts := strm.GenerateOptions{
 		SourcePath: mapping.Source,
 		TargetPath: mapping.Target,
 		Extensions: mapping.Extensions,
-		Concurrent: mapping.Concurrent,
-		Mode:       mapping.Mode,
 		STRMMode:   mapping.STRMMode,
+		DryRun:     opts.DryRun,
+	}
+	var movedTarget string
+	switch opts.Event {
+	case EventDelete:
+		return s.runDeleteEvent(ctx, task, genOpts, eventPath(mapping.Source, subpaths), traceID)
+	case EventMove:
+		from := resolveSourcePath(mapping.Source, opts.MovedFrom)
+		var deleted int
+		if alist.IsWithin(from, mapping.Source) {
+			movedTarget, deleted, err = s.generator.MoveSource(ctx, genOpts, from, eventPath(mapping.Source, subpaths), traceID)
+		} else {
+			err = fmt.Errorf("moved from %s outside source %s", from, mapping.Source)
+		}
+		if err != nil {
+			s.finishEvent(task, err, traceID)
+			return fmt.Errorf("[TraceID: %s] moving targets failed: %w", traceID, err)
+		}
+		log.Printf("[TraceID: %s] Moved targets of %s, removed %d STRM files to regenerate", traceID, from, deleted)
+		base.FilesDeleted += deleted
+	}
+
+	// Listing cache: incremental runs reuse listings of unchanged directories
+	// unless a periodic deep scan is due; deep scans only refresh the cache.
+	// Dry runs read the cache but never store listings.
+	var cache *dirCache
+	if mapping.ListingCache {
+		deepScan := mapping.Mode == "full" || deepScanDue(mapping, time.Now())
+		cache = newDirCache(s.db, !deepScan, !opts.DryRun, traceID)
+		if deepScan {
+			log.Printf("[TraceID: %s] Deep scan: listing cache will be refreshed, not used", traceID)
+		}
+	}
+
+	// Directories whose listings bypass Alist's cache
+	refresh := refreshSelector(mapping, opts.RefreshPaths)
+	discovery := mapping.Discovery
+	if len(opts.RefreshPaths) > 0 {
+		log.Printf("[TraceID: %s] Refreshing Alist listings for: %v", traceID, opts.RefreshPaths)
+		// A fresh file is not in the search index yet
+		discovery = "list"
+	}
+	if len(subpaths) > 0 {
+		// Subpaths are resolved from directory listings
+		discovery = "list"
+	}
+
+	// Finished directories are checkpointed so a failed or interrupted
+	// attempt can be resumed where it stopped
+	genMode := mapping.Mode
+	checkpoint, err := newCheckpoint(s.db, taskID, traceID, opts.Resume)
+	if err != nil {
+		log.Printf("[TraceID: %s] WARNING: Failed to load checkpoints, resuming from scratch: %v", traceID, err)
+		checkpoint, _ = newCheckpoint(s.db, taskID, traceID, false)
+	}
+	var walkCheckpoint strm.Checkpoint = checkpoint
+	if opts.DryRun {
+		// Nothing is written, so nothing can be resumed
+		walkCheckpoint = nil
+	}
+	if opts.Resume {
+		// The target was already cleaned by the first attempt of a full run
+		genMode = "incremental"
+		log.Printf("[TraceID: %s] Resuming task: %d directories already finished", traceID, checkpoint.resumedDirs())
+	}
+
+	// Generate STRM files (context now contains trace_id)
+	// Counters are persisted periodically so progress is visible while running
+	var lastProgress time.Time
+	result, err := s.generator.Generate(ctx, strm.GenerateOptions{
+		SourcePath:  mapping.Source,
+		TargetPath:  mapping.Target,
+		Extensions:  mapping.Extensions,
+		Concurrent:  mapping.Concurrent,
+		Mode:        genMode,
+		STRMMode:    mapping.STRMMode,
+		DryRun:      opts.DryRun,
+		Subpaths:    subpaths,
+		DirCache:    cache.walkCache(),
+		Discovery:   discovery,
+		IndexMaxAge: mapping.IndexMaxAge,
+		Refresh:     refresh,
+		Checkpoint:  walkCheckpoint,
+		OnProgress: func(p strm.GenerateResult) {
+			if time.Since(lastProgress) < progressInterval {
+				return
+			}
+			lastProgress = time.Now()
+			p = addCounters(base, p)
+			if err := s.db.UpdateTaskProgress(taskID, p.FilesCreated, p.FilesDeleted, p.FilesSkipped); err != nil {
+				log.Printf("[TraceID: %s] WARNING: Failed to update task progress: %v", traceID, err)
+			}
+		},
 	})
 
+	if err != nil {
+		// Directories finished so far are skipped when the task is resumed
+		checkpoint.flush()
+	}
+
+	if result != nil {
+		counters := addCounters(base, *result)
+		counters.Errors = result.Errors
+		counters.FailedPaths = result.FailedPaths
+		result = &counters
+	}
+
 	// Update task record
 	now := time.Now()
 	task.CompletedAt = &now
 	duration := now.Sub(task.StartedAt)
 
+	if err != nil && errors.Is(context.Cause(ctx), errShutdown) {
+		// Leave the task running; it is marked interrupted on the next start
+		if result != nil {
+			if updateErr := s.db.UpdateTaskProgress(task.TaskID, result.FilesCreated, result.FilesDeleted, result.FilesSkipped); updateErr != nil {
+				log.Printf("[TraceID: %s] WARNING: Failed to update task progress: %v", traceID, updateErr)
+			}
+		}
+		log.Printf("[TraceID: %s] Task INTERRUPTED by shutdown, duration=%v", traceID, duration)
+		return fmt.Errorf("[TraceID: %s] generation interrupted: %w", traceID, err)
+	}
 	if err != nil {
-		task.Status = "failed"
+		task.Status = storage.TaskStatusFailed
 		task.Errors = err.Error()
+		if errors.Is(err, context.Canceled) {
+			task.Status = storage.TaskStatusCancelled
+			if cause := context.Cause(ctx); cause != nil && cause != context.Canceled {
+				task.Errors = cause.Error()
+			}
+		}
+		if result != nil {
+			// Keep the partial counters of files written before the failure
+			task.FilesCreated = result.FilesCreated
+			task.FilesDeleted = result.FilesDeleted
+			task.FilesSkipped = result.FilesSkipped
+			task.FailedPaths = strings.Join(result.FailedPaths, "\n")
+		}
 		if updateErr := s.db.UpdateTask(task); updateErr != nil {
 			log.Printf("[TraceID: %s] WARNING: Failed to update task record: %v", traceID, updateErr)
 		}
-		log.Printf("[TraceID: %s] Task FAILED: error=%v, duration=%v", traceID, err, duration)
+		log.Printf("[TraceID: %s] Task %s: error=%v, duration=%v", traceID, strings.ToUpper(task.Status), task.Errors, duration)
+		if errors.Is(err, alist.ErrFolderPassword) {
+			log.Printf("[TraceID: %s] HINT: Source %s is password protected; set its password via /api/folder-passwords",
+				traceID, mapping.Source)
+		}
 		return fmt.Errorf("[TraceID: %s] generation failed: %w", traceID, err)
 	}
 
-	task.Status = "completed"
+	checkpoint.clear()
+	if !opts.DryRun && len(subpaths) == 0 {
+		// Resuming an earlier stopped run would redo what this run just did
+		if err := s.db.DeleteStoppedTaskCheckpoints(mapping.Name, taskID); err != nil {
+			log.Printf("[TraceID: %s] WARNING: Failed to delete checkpoints of stopped tasks: %v", traceID, err)
+		}
+	}
+	task.Status = storage.TaskStatusCompleted
 	task.FilesCreated = result.FilesCreated
 	task.FilesDeleted = result.FilesDeleted
 	task.FilesSkipped = result.FilesSkipped
+	task.FailedPaths = strings.Join(result.FailedPaths, "\n")
 
 	if len(result.Errors) > 0 {
 		errMsg := ""
+		passwordErrors := 0
 		for _, e := range result.Errors {
 			errMsg += e.Error() + "; "
+			if errors.Is(e, alist.ErrFolderPassword) {
+				passwordErrors++
+			}
 		}
 		task.Errors = errMsg
 		log.Printf("[TraceID: %s] Task completed with %d errors", traceID, len(result.Errors))
+		if passwordErrors > 0 {
+			log.Printf("[TraceID: %s] HINT: %d files failed because of a missing or wrong folder password; check /api/folder-passwords",
+				traceID, passwordErrors)
+		}
 	}
 
 	if err := s.db.UpdateTask(task); err != nil {
 		log.Printf("[TraceID: %s] WARNING: Failed to update task record: %v", traceID, err)
 	}
 
+	if cache != nil {
+		log.Printf("[TraceID: %s] Listing cache: %d directories served from cache", traceID, cache.hitCount())
+		// Only a scan of the whole source counts as a deep scan
+		if !cache.read && !opts.DryRun && len(subpaths) == 0 {
+			if err := s.db.UpdateMappingDeepScan(mapping.ID, now); err != nil {
+				log.Printf("[TraceID: %s] WARNING: Failed to record deep scan time: %v", traceID, err)
+			}
+		}
+	}
+
 	log.Printf("[TraceID: %s] Task COMPLETED: created=%d, deleted=%d, skipped=%d, errors=%d, duration=%v",
 		traceID, result.FilesCreated, result.FilesDeleted, result.FilesSkipped, len(result.Errors), duration)
 
 	// 通知媒体服务器扫描库
-	if result.FilesCreated > 0 || result.FilesDeleted > 0 {
-		log.Printf("[TraceID: %s] Notifying media server to scan library (target: %s)", traceID, mapping.Target)
-		if err := s.notifier.NotifyLibraryScan(ctx, mapping.Target); err != nil {
+	if opts.DryRun {
+		log.Printf("[TraceID: %s] Dry run, skipping media server notification", traceID)
+	} else if result.FilesCreated > 0 || result.FilesDeleted > 0 {
+		// 子路径任务只通知对应的目录或文件；移动事件通知旧路径已删除、新路径已修改
+		updateType := notification.UpdateCreated
+		var updates []notification.Update
+		if opts.Event == EventMove {
+			updateType = notification.UpdateModified
+			updates = append(updates, notification.Update{Path: movedTarget, UpdateType: notification.UpdateDeleted})
+		}
+		for _, target := range result.Targets {
+			updates = append(updates, notification.Update{Path: target, UpdateType: updateType})
+		}
+		log.Printf("[TraceID: %s] Notifying media server to scan library (targets: %v)", traceID, result.Targets)
+		if err := s.notifier.NotifyUpdates(ctx, updates); err != nil {
 			log.Printf("[TraceID: %s] WARNING: Failed to notify media server: %v", traceID, err)
 			// 不影响任务完成状态，仅记录日志
 		}
@@ -225,31 +585,53 @@ func (s *Scheduler) RunMapping(ctx context.Context, mapping config.MappingConfig
 	return nil
 }
 
+// addCounters returns the file counters of a and b added up, without errors
+func addCounters(a, b strm.GenerateResult) strm.GenerateResult {
+	return strm.GenerateResult{
+		FilesCreated: a.FilesCreated + b.FilesCreated,
+		FilesDeleted: a.FilesDeleted + b.FilesDeleted,
+		FilesSkipped: a.FilesSkipped + b.FilesSkipped,
+	}
+}
+
 // RunMappingByName runs a mapping by name (from database)
-func (s *Scheduler) RunMappingByName(ctx context.Context, name string) error {
+func (s *Scheduler) RunMappingByName(ctx context.Context, name string, opts RunOptions) error {
 	mapping, err := s.db.GetMappingByName(name)
 	if err != nil {
 		return fmt.Errorf("mapping not found: %s", name)
 	}
 
+	return s.RunMapping(ctx, mappingConfigFromModel(mapping), opts)
+}
+
+// mappingConfigFromModel converts a database mapping into a run configuration
+func mappingConfigFromModel(mapping *storage.Mapping) config.MappingConfig {
 	// Parse extensions from database (comma-separated string)
 	extensions := strings.Split(mapping.Extensions, ",")
 	for i := range extensions {
 		extensions[i] = strings.TrimSpace(extensions[i])
 	}
 
-	mappingConfig := config.MappingConfig{
-		Name:       mapping.Name,
-		Source:     mapping.Source,
-		Target:     mapping.Target,
-		Extensions: extensions,
-		Concurrent: mapping.Concurrent,
-		Mode:       mapping.Mode,
-		STRMMode:   mapping.STRMMode,
-		Enabled:    mapping.Enabled,
+	return config.MappingConfig{
+		ID:               mapping.ID,
+		Name:             mapping.Name,
+		Source:           mapping.Source,
+		Target:           mapping.Target,
+		Extensions:       extensions,
+		Concurrent:       mapping.Concurrent,
+		Mode:             mapping.Mode,
+		STRMMode:         mapping.STRMMode,
+		Enabled:          mapping.Enabled,
+		CronExpr:         mapping.CronExpr,
+		ListingCache:     mapping.ListingCache,
+		DeepScanInterval: time.Duration(mapping.DeepScanInterval) * time.Hour,
+		LastDeepScanAt:   mapping.LastDeepScanAt,
+		Discovery:        mapping.Discovery,
+		IndexMaxAge:      time.Duration(mapping.IndexMaxAge) * time.Hour,
+		RefreshPolicy:    mapping.RefreshPolicy,
+		RefreshPath:      mapping.RefreshPath,
+		ConflictPolicy:   mapping.ConflictPolicy,
 	}
-
-	return s.RunMapping(ctx, mappingConfig)
 }
 
 // GetTaskStatus gets task status by task ID
@@ -257,12 +639,14 @@ func (s *Scheduler) GetTaskStatus(taskID string) (*storage.Task, error) {
 	return s.db.GetTaskByID(taskID)
 }
 
-// AddCronJob adds a cron job for a mapping
-func (s *Scheduler) AddCronJob(mappingID uint, mappingName, cronExpr string) error {
+// AddCronJob adds a cron job for a mapping; the expression is evaluated in
+// timezone, or in local time when it is empty
+func (s *Scheduler) AddCronJob(mappingID uint, mappingName, cronExpr, timezone string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	log.Printf("[Scheduler] AddCronJob called: mappingID=%d, name=%s, expr=%s", mappingID, mappingName, cronExpr)
+	log.Printf("[Scheduler] AddCronJob called: mappingID=%d, name=%s, expr=%s, timezone=%s", mappingID, mappingName, cronExpr, timezone)
+	cronExpr = cronSpec(cronExpr, timezone)
 
 	// Remove existing job if any
 	if entryID, exists := s.cronJobs[mappingID]; exists {
@@ -272,20 +656,7 @@ func (s *Scheduler) AddCronJob(mappingID uint, mappingName, cronExpr string) err
 	}
 
 	// Add new cron job
-	entryID, err := s.cron.AddFunc(cronExpr, func() {
-		startTime := time.Now()
-		log.Printf("[Scheduler] ========== Cron job TRIGGERED: mapping=%s (ID: %d) ==========", mappingName, mappingID)
-
-		// RunMappingByName will create its own TraceID and log with it
-		if err := s.RunMappingByName(context.Background(), mappingName); err != nil {
-			// Extract TraceID from error message if present
-			log.Printf("[Scheduler] Scheduled task FAILED for mapping %s: %v", mappingName, err)
-		} else {
-			duration := time.Since(startTime)
-			log.Printf("[Scheduler] Scheduled task COMPLETED for mapping %s, duration: %v", mappingName, duration)
-		}
-		log.Printf("[Scheduler] ========== Cron job FINISHED: mapping=%s (ID: %d) ==========", mappingName, mappingID)
-	})
+	entryID, err := s.cron.AddFunc(cronExpr, func() { s.runScheduled(mappingID, mappingName) })
 	if err != nil {
 		log.Printf("[Scheduler] ERROR: Failed to create cron job for mapping %s: %v", mappingName, err)
 		return fmt.Errorf("failed to add cron job: %w", err)
@@ -294,9 +665,7 @@ func (s *Scheduler) AddCronJob(mappingID uint, mappingName, cronExpr string) err
 	s.cronJobs[mappingID] = entryID
 
 	// Calculate next execution time manually
-	// Support both 5-field (minute-based) and 6-field (second-based) cron expressions
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(cronExpr)
+	schedule, err := CronParser.Parse(cronExpr)
 	if err != nil {
 		log.Printf("[Scheduler] WARNING: Failed to parse cron expression for next time calculation: %v", err)
 		log.Printf("[Scheduler] Cron job REGISTERED successfully: mapping=%s (ID: %d), expr=%s",
@@ -310,6 +679,37 @@ func (s *Scheduler) AddCronJob(mappingID uint, mappingName, cronExpr string) err
 	return nil
 }
 
+// runScheduled queues the scheduled run of a mapping when its cron job
+// fires. A run with jitter is deferred rather than slept on, so it does not
+// hold up the cron scheduler on shutdown.
+func (s *Scheduler) runScheduled(mappingID uint, mappingName string) {
+	log.Printf("[Scheduler] ========== Cron job TRIGGERED: mapping=%s (ID: %d) ==========", mappingName, mappingID)
+	if err := s.db.UpdateMappingScheduledAt(mappingID, time.Now()); err != nil {
+		log.Printf("[Scheduler] WARNING: Failed to record scheduled run for mapping %s: %v", mappingName, err)
+	}
+
+	// Spread mappings scheduled at the same time
+	if mapping, err := s.db.GetMappingByName(mappingName); err == nil && mapping.Jitter > 0 {
+		if s.queue.isClosed() {
+			return
+		}
+		task, err := s.newQueuedTask(context.Background(), mappingName, TriggerCron, RunOptions{})
+		if err != nil {
+			log.Printf("[Scheduler] Scheduled task FAILED to queue for mapping %s: %v", mappingName, err)
+			return
+		}
+		s.deferJob(task, TriggerCron, RunOptions{}, time.Now().Add(cronJitter(mapping.Jitter)), "jitter")
+		return
+	}
+
+	// The queue worker creates the TraceID from the task ID and logs with it
+	if taskID, err := s.Enqueue(context.Background(), mappingName, TriggerCron, RunOptions{}); err != nil {
+		log.Printf("[Scheduler] Scheduled task FAILED to queue for mapping %s: %v", mappingName, err)
+	} else {
+		log.Printf("[Scheduler] Scheduled task QUEUED for mapping %s: task=%s", mappingName, taskID)
+	}
+}
+
 // RemoveCronJob removes a cron job for a mapping
 func (s *Scheduler) RemoveCronJob(mappingID uint) {
 	s.mu.Lock()
@@ -324,10 +724,13 @@ func (s *Scheduler) RemoveCronJob(mappingID uint) {
 	} else {
 		log.Printf("[Scheduler] No cron job found for mapping ID: %d, skipping removal", mappingID)
 	}
+	if mapping, err := s.db.GetMappingByID(mappingID); err == nil {
+		s.cancelDeferredTrigger(mapping.Name, TriggerCron, "scheduled run removed")
+	}
 }
 
 // UpdateCronJob updates a cron job for a mapping
-func (s *Scheduler) UpdateCronJob(mappingID uint, mappingName, cronExpr string, enabled bool) error {
+func (s *Scheduler) UpdateCronJob(mappingID uint, mappingName, cronExpr, timezone string, enabled bool) error {
 	log.Printf("[Scheduler] UpdateCronJob called: mappingID=%d, name=%s, expr=%s, enabled=%v",
 		mappingID, mappingName, cronExpr, enabled)
 
@@ -344,5 +747,5 @@ func (s *Scheduler) UpdateCronJob(mappingID uint, mappingName, cronExpr string,
 
 	// Otherwise, add/update the job
 	log.Printf("[Scheduler] Updating cron job for mapping %s", mappingName)
-	return s.AddCronJob(mappingID, mappingName, cronExpr)
+	return s.AddCronJob(mappingID, mappingName, cronExpr, timezone)
 }
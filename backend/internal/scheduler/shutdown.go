@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+// shutdownGrace bounds how long Shutdown waits for cancelled tasks to stop
+const shutdownGrace = 10 * time.Second
+
+// errShutdown is the cancellation cause of tasks stopped by Shutdown
+var errShutdown = errors.New("interrupted by shutdown")
+
+// Shutdown stops accepting tasks and waits for running tasks to finish.
+// When ctx expires first, running tasks are cancelled; they keep their
+// partial counters and are marked interrupted on the next start, like
+// tasks that were still queued.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	if s.cron != nil {
+		<-s.cron.Stop().Done()
+	}
+	s.dropBatches()
+	s.dropDeferred()
+	s.queue.close()
+
+	done := make(chan struct{})
+	go func() {
+		s.workerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("[Scheduler] Scheduler stopped, all running tasks finished")
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Println("[Scheduler] Shutdown timeout reached, cancelling running tasks")
+	s.queue.cancelRunning(errShutdown)
+	select {
+	case <-done:
+		log.Println("[Scheduler] Scheduler stopped, running tasks cancelled")
+	case <-time.After(shutdownGrace):
+		log.Printf("[Scheduler] WARNING: Running tasks did not stop within %v", shutdownGrace)
+	}
+	return ctx.Err()
+}
+
+// recoverTasks prunes expired checkpoints, then marks tasks left running or
+// queued by the previous process as interrupted and, if configured, resumes
+// each of them with the options recorded on the task.
+func (s *Scheduler) recoverTasks() {
+	s.pruneCheckpoints()
+
+	var leftovers []*storage.Task
+	for _, status := range []string{storage.TaskStatusRunning, storage.TaskStatusQueued} {
+		tasks, err := s.db.GetTasksByStatus(status, -1)
+		if err != nil {
+			log.Printf("[Scheduler] WARNING: Failed to list %s tasks: %v", status, err)
+			continue
+		}
+		leftovers = append(leftovers, tasks...)
+	}
+	if len(leftovers) == 0 {
+		return
+	}
+	log.Printf("[Scheduler] Found %d tasks interrupted by the previous shutdown", len(leftovers))
+
+	// Oldest first so requeued runs keep their order
+	for i := len(leftovers) - 1; i >= 0; i-- {
+		task := leftovers[i]
+		now := time.Now()
+		task.Status = storage.TaskStatusInterrupted
+		task.Errors = errShutdown.Error()
+		task.CompletedAt = &now
+		if err := s.db.UpdateTask(task); err != nil {
+			log.Printf("[Scheduler] WARNING: Failed to mark task %s interrupted: %v", task.TaskID, err)
+			continue
+		}
+
+		if s.cfg.Scheduler.RequeueInterrupted {
+			trigger := task.Trigger
+			if trigger == "" {
+				trigger = TriggerManual
+			}
+			if err := s.resumeTask(task, trigger); err != nil {
+				log.Printf("[Scheduler] WARNING: Failed to resume task %s: %v", task.TaskID, err)
+				// Not resumed: failed for good, so its webhook event is retried
+				task.Status = storage.TaskStatusFailed
+				task.Errors = fmt.Sprintf("%s; resume failed: %v", errShutdown, err)
+				if err := s.db.UpdateTask(task); err != nil {
+					log.Printf("[Scheduler] WARNING: Failed to mark task %s failed: %v", task.TaskID, err)
+				}
+			}
+		}
+	}
+}
+
+// pruneCheckpoints deletes the checkpoints of tasks that cannot be resumed
+// and of stopped tasks older than the checkpoint retention
+func (s *Scheduler) pruneCheckpoints() {
+	before := time.Now().Add(-s.cfg.Scheduler.CheckpointRetention * time.Hour)
+	n, err := s.db.PruneTaskCheckpoints(before)
+	if err != nil {
+		log.Printf("[Scheduler] WARNING: Failed to prune task checkpoints: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[Scheduler] Pruned %d task checkpoints", n)
+	}
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/konghanghang/openlist-strm/internal/storage"
+)
+
+func TestRecoverTasks_Requeue(t *testing.T) {
+	s := newTestScheduler(t)
+	s.cfg.Scheduler.RequeueInterrupted = true
+	if err := s.db.CreateMapping(&storage.Mapping{Name: "movies", Source: "/media", Target: "/strm"}); err != nil {
+		t.Fatalf("failed to create mapping: %v", err)
+	}
+	for _, task := range []*storage.Task{
+		{TaskID: "running-task", ConfigName: "movies", Status: storage.TaskStatusRunning, Trigger: TriggerWebhook, FilesCreated: 5},
+		{TaskID: "queued-task", ConfigName: "movies", Status: storage.TaskStatusQueued, Trigger: TriggerCron},
+		{TaskID: "done-task", ConfigName: "movies", Status: storage.TaskStatusCompleted},
+	} {
+		task.StartedAt = time.Now()
+		if err := s.db.CreateTask(task); err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+	}
+
+	s.recoverTasks()
+
+	// Both leftovers are resumed in place under their own task IDs
+	for _, id := range []string{"running-task", "queued-task"} {
+		task, _ := s.db.GetTaskByID(id)
+		if task.Status != storage.TaskStatusQueued || task.CompletedAt != nil {
+			t.Errorf("%s: expected queued again, got %s", id, task.Status)
+		}
+	}
+	if task, _ := s.db.GetTaskByID("running-task"); task.FilesCreated != 5 {
+		t.Errorf("expected partial counters to be kept, got %d", task.FilesCreated)
+	}
+	if task, _ := s.db.GetTaskByID("done-task"); task.Status != storage.TaskStatusCompleted {
+		t.Errorf("finished task should be untouched, got %s", task.Status)
+	}
+
+	_, pending := s.queue.snapshot()
+	if len(pending) != 2 || pending[0].TaskID != "running-task" || pending[1].TaskID != "queued-task" {
+		t.Fatalf("expected resumed webhook and cron jobs, got %+v", pending)
+	}
+	if !pending[0].Opts.Resume || pending[0].Trigger != TriggerWebhook {
+		t.Errorf("expected a resumed webhook job, got %+v", pending[0])
+	}
+}
+
+func TestRecoverTasks_MarksInterrupted(t *testing.T) {
+	s := newTestScheduler(t)
+	task := &storage.Task{TaskID: "running-task", ConfigName: "movies", Status: storage.TaskStatusRunning, StartedAt: time.Now()}
+	if err := s.db.CreateTask(task); err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	s.recoverTasks()
+
+	got, _ := s.db.GetTaskByID("running-task")
+	if got.Status != storage.TaskStatusInterrupted || got.CompletedAt == nil {
+		t.Fatalf("expected interrupted, got %s", got.Status)
+	}
+	if _, pending := s.queue.snapshot(); len(pending) != 0 {
+		t.Fatalf("expected nothing queued, got %d jobs", len(pending))
+	}
+}
+
+func TestShutdown_CancelsAfterTimeout(t *testing.T) {
+	s := newTestScheduler(t)
+	s.workers = 1
+
+	job := &Job{TaskID: "slow-task-id", Mapping: "movies"}
+	job.ctx, job.cancel = context.WithCancelCause(context.Background())
+	if err := s.queue.push(job); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	// Worker that blocks until its task is cancelled
+	s.workerWG.Add(1)
+	go func() {
+		defer s.workerWG.Done()
+		for j := s.queue.pop(); j != nil; j = s.queue.pop() {
+			<-j.ctx.Done()
+			s.queue.done(j)
+		}
+	}()
+	waitFor(t, func() bool {
+		running, _ := s.queue.snapshot()
+		return len(running) == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if cause := context.Cause(job.ctx); cause != errShutdown {
+		t.Fatalf("expected errShutdown cause, got %v", cause)
+	}
+	if _, err := s.Enqueue(context.Background(), "movies", TriggerManual, RunOptions{}); err != ErrShuttingDown {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBox_RoundTrip(t *testing.T) {
+	box, err := Open("passphrase", "")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	enc, err := box.Encrypt("folder-password")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if enc == "folder-password" {
+		t.Error("Encrypt() returned the plaintext")
+	}
+
+	dec, err := box.Decrypt(enc)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if dec != "folder-password" {
+		t.Errorf("Decrypt() = %v, want folder-password", dec)
+	}
+
+	other, _ := Open("another-passphrase", "")
+	if _, err := other.Decrypt(enc); err == nil {
+		t.Error("Decrypt() with a different key expected error, got nil")
+	}
+}
+
+func TestOpen_KeyFileIsCreatedAndReused(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "data", "secret.key")
+
+	first, err := Open("", keyFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	enc, _ := first.Encrypt("value")
+
+	second, err := Open("", keyFile)
+	if err != nil {
+		t.Fatalf("Open() second time error = %v", err)
+	}
+	if dec, err := second.Decrypt(enc); err != nil || dec != "value" {
+		t.Errorf("Decrypt() with reloaded key = %v, %v; want value", dec, err)
+	}
+}
@@ -16,13 +16,36 @@ type File struct {
 	UpdatedAt  time.Time
 }
 
+// Task statuses
+const (
+	TaskStatusQueued      = "queued"      // waiting to run
+	TaskStatusRunning     = "running"     // generating
+	TaskStatusCompleted   = "completed"   // finished, possibly with per-file errors
+	TaskStatusFailed      = "failed"      // aborted by an error
+	TaskStatusSkipped     = "skipped"     // dropped because the mapping was busy
+	TaskStatusCancelled   = "cancelled"   // stopped before finishing
+	TaskStatusInterrupted = "interrupted" // stopped by a shutdown or crash
+)
+
 // Task represents a task execution record
 type Task struct {
 	ID           uint   `gorm:"primarykey"`
 	TaskID       string `gorm:"uniqueIndex;not null"`
 	ConfigName   string `gorm:"index"`
 	Mode         string // incremental or full
-	Status       string `gorm:"index"` // running, completed, failed
+	STRMMode     string // alist_path or http_url
+	Concurrent   int
+	DryRun       bool   // nothing was written
+	Refresh      bool   // listings bypassed Alist's cache
+	RefreshPaths string // newline-separated Alist paths whose listings bypassed Alist's cache
+	Trigger      string // manual, webhook, cron, startup, change, chain or retry; empty for direct runs
+	Event        string // delete or move for file events; empty for generation runs
+	Subpaths     string // newline-separated Alist paths the run was limited to; empty for the whole source
+	Type         string // validate for validation tasks; empty for generation
+	ParentTaskID string `gorm:"index"` // task whose completion queued this follow-up or retry
+	Attempt      int    // retry attempt, 0 for the first run
+	FailedPaths  string `gorm:"type:text"` // newline-separated Alist paths of files that failed
+	Status       string `gorm:"index"`     // see TaskStatus* constants
 	FilesCreated int
 	FilesDeleted int
 	FilesSkipped int
@@ -45,8 +68,55 @@ type Mapping struct {
 	STRMMode   string `gorm:"column:strm_mode;default:alist_path"` // alist_path or http_url
 	Enabled    bool   `gorm:"default:true"`                        // 是否启用
 	CronExpr   string `gorm:"default:"`                            // Cron 表达式，为空则不启用定时
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+
+	ListingCache     bool       `gorm:"default:false"` // 增量模式下复用未变化目录的列表缓存
+	DeepScanInterval int        `gorm:"default:24"`    // 强制完整扫描的间隔（小时）
+	LastDeepScanAt   *time.Time // 上次完整扫描时间
+
+	Discovery   string `gorm:"default:list"` // 文件发现方式：list（逐级列目录）或 search（Alist 搜索索引）
+	IndexMaxAge int    `gorm:"default:0"`    // search 模式下索引的最大有效时长（小时），0 表示不检查
+
+	RefreshPolicy string `gorm:"default:never"` // 强制刷新 Alist 缓存：never/top/subpath/always
+	RefreshPath   string // subpath 策略刷新的路径（相对源路径或 Alist 绝对路径）
+
+	ConflictPolicy string `gorm:"default:queue"` // 任务运行中再次触发时：skip 跳过 / queue 排队一次 / cancel 取消当前任务
+
+	CatchUpPolicy   string     `gorm:"default:once"` // 停机错过定时任务时：none 不补跑 / once 启动后补跑一次
+	LastScheduledAt *time.Time // 上次定时触发时间
+
+	RunOnStartup bool `gorm:"default:false"` // 程序启动时执行一次
+	RunOnChange  bool `gorm:"default:false"` // 创建或修改源路径、目标路径、规则后自动执行
+
+	Timezone        string // Cron 表达式和禁止时段使用的时区（IANA 名称），为空则使用本地时区
+	Jitter          int    `gorm:"default:0"` // 定时任务随机延迟的最大秒数
+	BlackoutWindows string // 禁止时段，如 19:00-23:00,01:00-02:00；定时和 Webhook 任务推迟到时段结束
+
+	FollowUps string `gorm:"type:text"` // 任务结束后执行的后续任务（JSON）
+
+	RetryMaxAttempts int `gorm:"default:0"`  // 任务失败或有文件失败时的最大重试次数，0 表示不重试
+	RetryBackoff     int `gorm:"default:60"` // 首次重试前的等待时间（秒），之后每次翻倍
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DirListing represents a cached Alist directory listing
+type DirListing struct {
+	ID        uint      `gorm:"primarykey"`
+	Path      string    `gorm:"uniqueIndex;not null"` // Alist 目录路径
+	Modified  time.Time // 列表对应的目录修改时间
+	Entries   string    `gorm:"type:text"` // 子项列表（JSON）
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TaskCheckpoint records a directory whose files were all written by a task
+type TaskCheckpoint struct {
+	ID        uint   `gorm:"primarykey"`
+	TaskID    string `gorm:"uniqueIndex:idx_task_checkpoint;not null"`
+	Dir       string `gorm:"uniqueIndex:idx_task_checkpoint;not null"` // Alist 目录路径
+	Subdirs   string `gorm:"type:text"`                                // 子目录列表（JSON），null 表示未知
+	CreatedAt time.Time
 }
 
 // User represents a user account
@@ -59,6 +129,16 @@ type User struct {
 	UpdatedAt    time.Time
 }
 
+// FolderPassword represents the password of a meta-protected Alist folder
+type FolderPassword struct {
+	ID         uint   `gorm:"primarykey"`
+	PathPrefix string `gorm:"uniqueIndex;not null"` // Alist 路径前缀，对其下所有路径生效
+	Password   string `gorm:"not null"`             // 加密后的密码
+	Note       string // 备注
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
 // TableName specifies custom table names
 func (File) TableName() string {
 	return "files"
@@ -75,3 +155,59 @@ func (Mapping) TableName() string {
 func (User) TableName() string {
 	return "users"
 }
+
+func (DirListing) TableName() string {
+	return "dir_listings"
+}
+
+func (FolderPassword) TableName() string {
+	return "folder_passwords"
+}
+
+// Webhook event statuses
+const (
+	WebhookEventPending    = "pending"    // waiting to be processed or retried
+	WebhookEventProcessing = "processing" // claimed by a request, the inbox or a replay
+	WebhookEventQueued     = "queued"     // its task is queued or running
+	WebhookEventProcessed  = "processed"  // its task finished
+	WebhookEventSkipped    = "skipped"    // nothing to do, e.g. no matching mapping
+	WebhookEventFailed     = "failed"     // invalid, or retries exhausted
+)
+
+// WebhookEvent represents a received webhook kept until it was handled
+type WebhookEvent struct {
+	ID            uint      `gorm:"primarykey"`
+	Payload       string    `gorm:"type:text;not null"` // 原始请求（JSON）
+	Path          string    // 请求中的路径，便于查看
+	Event         string    // 请求中的事件类型
+	Status        string    `gorm:"index"` // see WebhookEvent* constants
+	Attempts      int       // 已处理次数
+	NextAttemptAt time.Time `gorm:"index"` // pending 状态下次处理时间；processing 状态超过该时间可被接管
+	TaskID        string    `gorm:"index"` // 最近一次处理创建的任务
+	LastError     string    `gorm:"type:text"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// PathRule represents a path translation rule applied to webhooks that do
+// not send their own drive_path/alist_path
+type PathRule struct {
+	ID          uint   `gorm:"primarykey"`
+	Name        string `gorm:"uniqueIndex;not null"` // 规则名称
+	DrivePrefix string `gorm:"not null"`             // 网盘/下载器路径前缀
+	AlistPrefix string `gorm:"not null"`             // 对应的 Alist 路径前缀
+	Source      string `gorm:"index"`                // 仅对该来源标识的 Webhook 生效，为空则对所有来源生效
+	Enabled     bool   // 是否启用
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebhookSecret represents the HMAC secret of a webhook source
+type WebhookSecret struct {
+	ID        uint   `gorm:"primarykey"`
+	Source    string `gorm:"uniqueIndex;not null"` // 来源标识，如 sonarr、qbittorrent
+	Secret    string `gorm:"not null"`             // 加密后的签名密钥
+	Note      string // 备注
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
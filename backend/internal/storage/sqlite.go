@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -32,10 +34,18 @@ func New(dbPath string) (*DB, error) {
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&File{}, &Task{}, &Mapping{}, &User{}); err != nil {
+	if err := db.AutoMigrate(&File{}, &Task{}, &Mapping{}, &User{}, &DirListing{}, &FolderPassword{}, &TaskCheckpoint{}, &WebhookEvent{}, &PathRule{}, &WebhookSecret{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// SQLite allows a single writer; serialize access instead of failing with
+	// "database is locked" when scans write concurrently
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database handle: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
 	return &DB{DB: db}, nil
 }
 
@@ -90,6 +100,15 @@ func (db *DB) UpdateTask(task *Task) error {
 	return db.DB.Save(task).Error
 }
 
+// UpdateTaskProgress updates the file counters of a running task
+func (db *DB) UpdateTaskProgress(taskID string, created, deleted, skipped int) error {
+	return db.DB.Model(&Task{}).Where("task_id = ?", taskID).Updates(map[string]interface{}{
+		"files_created": created,
+		"files_deleted": deleted,
+		"files_skipped": skipped,
+	}).Error
+}
+
 // GetTaskByID gets a task by task ID
 func (db *DB) GetTaskByID(taskID string) (*Task, error) {
 	var task Task
@@ -146,9 +165,11 @@ func (db *DB) CreateMapping(mapping *Mapping) error {
 	return db.DB.Create(mapping).Error
 }
 
-// UpdateMapping updates a mapping configuration
+// UpdateMapping updates a mapping configuration. The times recorded by the
+// scheduler are left as stored, since a run may have updated them after the
+// mapping was read; use UpdateMappingScheduledAt and UpdateMappingDeepScan
 func (db *DB) UpdateMapping(mapping *Mapping) error {
-	return db.DB.Save(mapping).Error
+	return db.DB.Omit("last_scheduled_at", "last_deep_scan_at").Save(mapping).Error
 }
 
 // GetMappingByID gets a mapping by ID
@@ -203,5 +224,260 @@ func (db *DB) UpsertMapping(mapping *Mapping) error {
 	}
 	// Update existing
 	mapping.ID = existing.ID
-	return db.DB.Save(mapping).Error
+	return db.UpdateMapping(mapping)
+}
+
+// UpdateMappingScheduledAt records the time a mapping's cron schedule last fired
+func (db *DB) UpdateMappingScheduledAt(id uint, firedAt time.Time) error {
+	return db.DB.Model(&Mapping{}).Where("id = ?", id).Update("last_scheduled_at", firedAt).Error
+}
+
+// UpdateMappingDeepScan records the time of the last full (uncached) scan of a mapping
+func (db *DB) UpdateMappingDeepScan(id uint, scannedAt time.Time) error {
+	return db.DB.Model(&Mapping{}).Where("id = ?", id).Update("last_deep_scan_at", scannedAt).Error
+}
+
+// GetDirListing gets the cached listing of a directory
+func (db *DB) GetDirListing(path string) (*DirListing, error) {
+	var listing DirListing
+	err := db.DB.Where("path = ?", path).First(&listing).Error
+	if err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
+
+// SaveDirListing creates or replaces the cached listing of a directory
+func (db *DB) SaveDirListing(listing *DirListing) error {
+	return db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"modified", "entries", "updated_at"}),
+	}).Create(listing).Error
+}
+
+// SaveTaskCheckpoints records finished directories of tasks in one transaction
+func (db *DB) SaveTaskCheckpoints(checkpoints []*TaskCheckpoint) error {
+	if len(checkpoints) == 0 {
+		return nil
+	}
+	return db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}, {Name: "dir"}},
+		DoUpdates: clause.AssignmentColumns([]string{"subdirs"}),
+	}).CreateInBatches(checkpoints, 100).Error
+}
+
+// ListTaskCheckpoints lists the finished directories of a task
+func (db *DB) ListTaskCheckpoints(taskID string) ([]*TaskCheckpoint, error) {
+	var checkpoints []*TaskCheckpoint
+	err := db.DB.Where("task_id = ?", taskID).Find(&checkpoints).Error
+	return checkpoints, err
+}
+
+// DeleteTaskCheckpoints deletes the checkpoints of a task
+func (db *DB) DeleteTaskCheckpoints(taskID string) error {
+	return db.DB.Where("task_id = ?", taskID).Delete(&TaskCheckpoint{}).Error
+}
+
+// DeleteStoppedTaskCheckpoints deletes the checkpoints of the failed,
+// cancelled and interrupted tasks of a mapping except keepTaskID
+func (db *DB) DeleteStoppedTaskCheckpoints(configName, keepTaskID string) error {
+	stopped := db.DB.Model(&Task{}).Select("task_id").
+		Where("config_name = ? AND status IN ? AND task_id <> ?", configName,
+			[]string{TaskStatusFailed, TaskStatusCancelled, TaskStatusInterrupted}, keepTaskID)
+	return db.DB.Where("task_id IN (?)", stopped).Delete(&TaskCheckpoint{}).Error
+}
+
+// PruneTaskCheckpoints deletes the checkpoints of tasks that cannot be
+// resumed any more and of resumable tasks that stopped before before,
+// returning the number of rows deleted
+func (db *DB) PruneTaskCheckpoints(before time.Time) (int64, error) {
+	keep := db.DB.Model(&Task{}).Select("task_id").
+		Where("status IN ? AND (completed_at IS NULL OR completed_at >= ?)",
+			[]string{TaskStatusQueued, TaskStatusRunning, TaskStatusFailed, TaskStatusCancelled, TaskStatusInterrupted}, before)
+	result := db.DB.Where("task_id NOT IN (?)", keep).Delete(&TaskCheckpoint{})
+	return result.RowsAffected, result.Error
+}
+
+// ListFolderPasswords lists all folder passwords
+func (db *DB) ListFolderPasswords() ([]*FolderPassword, error) {
+	var passwords []*FolderPassword
+	err := db.DB.Order("path_prefix ASC").Find(&passwords).Error
+	return passwords, err
+}
+
+// UpsertFolderPassword creates or updates the password of a path prefix
+func (db *DB) UpsertFolderPassword(fp *FolderPassword) error {
+	var existing FolderPassword
+	err := db.DB.Where("path_prefix = ?", fp.PathPrefix).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return db.DB.Create(fp).Error
+	}
+	if err != nil {
+		return err
+	}
+	fp.ID = existing.ID
+	fp.CreatedAt = existing.CreatedAt
+	return db.DB.Save(fp).Error
+}
+
+// DeleteFolderPassword deletes a folder password by ID
+func (db *DB) DeleteFolderPassword(id uint) error {
+	return db.DB.Delete(&FolderPassword{}, id).Error
+}
+
+// CreateWebhookEvent stores a received webhook event
+func (db *DB) CreateWebhookEvent(event *WebhookEvent) error {
+	return db.DB.Create(event).Error
+}
+
+// UpdateWebhookEvent updates a webhook event
+func (db *DB) UpdateWebhookEvent(event *WebhookEvent) error {
+	return db.DB.Save(event).Error
+}
+
+// GetWebhookEvent gets a webhook event by ID
+func (db *DB) GetWebhookEvent(id uint) (*WebhookEvent, error) {
+	var event WebhookEvent
+	err := db.DB.First(&event, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListWebhookEvents lists webhook events, newest first; an empty status
+// lists all of them
+func (db *DB) ListWebhookEvents(status string, limit, offset int) ([]*WebhookEvent, error) {
+	var events []*WebhookEvent
+	query := db.DB.Order("id DESC").Limit(limit).Offset(offset)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// CountWebhookEvents counts webhook events; an empty status counts all of
+// them
+func (db *DB) CountWebhookEvents(status string) (int64, error) {
+	var count int64
+	query := db.DB.Model(&WebhookEvent{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// ListDueWebhookEvents lists pending webhook events due at now and events
+// whose processing claim expired, oldest first
+func (db *DB) ListDueWebhookEvents(now time.Time) ([]*WebhookEvent, error) {
+	var events []*WebhookEvent
+	err := db.DB.Where("status IN ? AND next_attempt_at <= ?",
+		[]string{WebhookEventPending, WebhookEventProcessing}, now).Order("id ASC").Find(&events).Error
+	return events, err
+}
+
+// ClaimWebhookEvent marks event as processing until until, provided its
+// status is still the one it was read with; a processing event can only be
+// claimed once its previous claim expired at now. It reports whether the
+// event was claimed, so only one of concurrent claims processes it.
+func (db *DB) ClaimWebhookEvent(event *WebhookEvent, now, until time.Time) (bool, error) {
+	result := db.DB.Model(&WebhookEvent{}).
+		Where("id = ? AND status = ? AND (status <> ? OR next_attempt_at <= ?)",
+			event.ID, event.Status, WebhookEventProcessing, now).
+		Updates(map[string]any{"status": WebhookEventProcessing, "next_attempt_at": until})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	event.Status = WebhookEventProcessing
+	event.NextAttemptAt = until
+	return true, nil
+}
+
+// PruneWebhookEvents deletes processed, skipped and failed webhook events
+// last updated before before, returning the number of events deleted
+func (db *DB) PruneWebhookEvents(before time.Time) (int64, error) {
+	result := db.DB.Where("status IN ? AND updated_at < ?",
+		[]string{WebhookEventProcessed, WebhookEventSkipped, WebhookEventFailed}, before).Delete(&WebhookEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// ListPathRules lists all path translation rules
+func (db *DB) ListPathRules() ([]*PathRule, error) {
+	var rules []*PathRule
+	err := db.DB.Order("name ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetPathRuleByID gets a path translation rule by ID
+func (db *DB) GetPathRuleByID(id uint) (*PathRule, error) {
+	var rule PathRule
+	err := db.DB.First(&rule, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetPathRuleByName gets a path translation rule by name
+func (db *DB) GetPathRuleByName(name string) (*PathRule, error) {
+	var rule PathRule
+	err := db.DB.Where("name = ?", name).First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreatePathRule creates a path translation rule
+func (db *DB) CreatePathRule(rule *PathRule) error {
+	return db.DB.Create(rule).Error
+}
+
+// UpdatePathRule updates a path translation rule
+func (db *DB) UpdatePathRule(rule *PathRule) error {
+	return db.DB.Save(rule).Error
+}
+
+// DeletePathRule deletes a path translation rule by ID
+func (db *DB) DeletePathRule(id uint) error {
+	return db.DB.Delete(&PathRule{}, id).Error
+}
+
+// ListWebhookSecrets lists all webhook secrets
+func (db *DB) ListWebhookSecrets() ([]*WebhookSecret, error) {
+	var secrets []*WebhookSecret
+	err := db.DB.Order("source ASC").Find(&secrets).Error
+	return secrets, err
+}
+
+// GetWebhookSecret gets the webhook secret of a source
+func (db *DB) GetWebhookSecret(source string) (*WebhookSecret, error) {
+	var secret WebhookSecret
+	err := db.DB.Where("source = ?", source).First(&secret).Error
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// UpsertWebhookSecret creates or replaces the webhook secret of a source
+func (db *DB) UpsertWebhookSecret(secret *WebhookSecret) error {
+	var existing WebhookSecret
+	err := db.DB.Where("source = ?", secret.Source).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return db.DB.Create(secret).Error
+	}
+	if err != nil {
+		return err
+	}
+	secret.ID = existing.ID
+	secret.CreatedAt = existing.CreatedAt
+	return db.DB.Save(secret).Error
+}
+
+// DeleteWebhookSecret deletes a webhook secret by ID
+func (db *DB) DeleteWebhookSecret(id uint) error {
+	return db.DB.Delete(&WebhookSecret{}, id).Error
 }
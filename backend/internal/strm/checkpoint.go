@@ -0,0 +1,93 @@
+package strm
+
+import "sync"
+
+// Checkpoint records which directories a run has finished so that an
+// interrupted run can be resumed without redoing them
+type Checkpoint interface {
+	// DirDone reports whether all files of dir were handled by an earlier run
+	DirDone(dir string) bool
+	// SubtreeDone reports whether dir and every directory below it were
+	// handled by an earlier run, so dir need not be listed again
+	SubtreeDone(dir string) bool
+	// MarkDir records that every file of dir was handled without error;
+	// subdirs are the directories listed below dir, nil when unknown
+	MarkDir(dir string, subdirs []string)
+}
+
+// dirTracker counts the outstanding files of each directory and marks a
+// directory in the checkpoint once the walk is done with it and all of its
+// files have been written
+type dirTracker struct {
+	checkpoint Checkpoint
+
+	mu   sync.Mutex
+	dirs map[string]*dirState
+}
+
+type dirState struct {
+	outstanding int      // files queued but not yet handled
+	failed      bool     // a file failed or was dropped on cancellation
+	walked      bool     // OnDir was called: no more files will be queued
+	subdirs     []string // as passed to OnDir
+}
+
+func newDirTracker(checkpoint Checkpoint) *dirTracker {
+	return &dirTracker{checkpoint: checkpoint, dirs: make(map[string]*dirState)}
+}
+
+func (t *dirTracker) state(dir string) *dirState {
+	st, ok := t.dirs[dir]
+	if !ok {
+		st = &dirState{}
+		t.dirs[dir] = st
+	}
+	return st
+}
+
+// queued records n files of dir about to be sent to the writers
+func (t *dirTracker) queued(dir string, n int) {
+	t.mu.Lock()
+	t.state(dir).outstanding += n
+	t.mu.Unlock()
+}
+
+// walked records that the walk delivered all files of dir
+func (t *dirTracker) walked(dir string, subdirs []string) {
+	t.mu.Lock()
+	st := t.state(dir)
+	st.walked = true
+	st.subdirs = subdirs
+	done := t.finishLocked(dir, st)
+	t.mu.Unlock()
+
+	if done {
+		t.checkpoint.MarkDir(dir, subdirs)
+	}
+}
+
+// handled records the outcome of one file of dir
+func (t *dirTracker) handled(dir string, ok bool) {
+	t.mu.Lock()
+	st := t.state(dir)
+	st.outstanding--
+	if !ok {
+		st.failed = true
+	}
+	done := t.finishLocked(dir, st)
+	t.mu.Unlock()
+
+	if done {
+		t.checkpoint.MarkDir(dir, st.subdirs)
+	}
+}
+
+// finishLocked forgets dir once it is complete and reports whether it
+// should be marked in the checkpoint
+func (t *dirTracker) finishLocked(dir string, st *dirState) bool {
+	if !st.walked || st.outstanding > 0 {
+		return false
+	}
+	delete(t.dirs, dir)
+	return !st.failed
+}
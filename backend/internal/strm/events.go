@@ -0,0 +1,275 @@
+package strm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+)
+
+// errSourceRoot is returned for events on the source directory itself,
+// which would affect the whole target
+var errSourceRoot = errors.New("event path is the mapping source itself")
+
+// RemoveSource removes what was generated for the deleted source path p:
+// the target directory of a directory, or the STRM file of a video file
+// together with its sidecar files (nfo, artwork, subtitles named after the
+// video). Files without one of the mapping's extensions are ignored, and the
+// STRM file is kept while another video with the same base name is still
+// listed next to p. It returns the target path and the number of STRM files
+// removed.
+func (g *Generator) RemoveSource(ctx context.Context, opts GenerateOptions, p, traceID string) (string, int, error) {
+	if relSourcePath(opts.SourcePath, p) == "" {
+		return "", 0, errSourceRoot
+	}
+	target, isDir := sourceTarget(opts, p)
+	if isDir {
+		n, err := removeTree(target, opts.DryRun, traceID)
+		return target, n, err
+	}
+	if keep, err := g.keepTarget(ctx, opts, p, traceID); keep || err != nil {
+		return target, 0, err
+	}
+
+	n := 0
+	for _, f := range sidecars(target) {
+		if err := removeFile(f, opts.DryRun, traceID); err != nil {
+			return target, n, err
+		}
+		if filepath.Ext(f) == ".strm" {
+			n++
+		}
+	}
+	return target, n, nil
+}
+
+// MoveSource moves the sidecar files generated for the renamed source path
+// from to the location of to. STRM files refer to the old source path, so
+// they are removed instead; a run limited to the new path writes them
+// again. A file is skipped like in RemoveSource when it is not a video or
+// another video with its base name is still listed. It returns the old
+// target path and the number of STRM files removed.
+func (g *Generator) MoveSource(ctx context.Context, opts GenerateOptions, from, to, traceID string) (string, int, error) {
+	if relSourcePath(opts.SourcePath, from) == "" || relSourcePath(opts.SourcePath, to) == "" {
+		return "", 0, errSourceRoot
+	}
+	oldTarget, isDir := sourceTarget(opts, from)
+	newTarget := filepath.Join(opts.TargetPath, relSourcePath(opts.SourcePath, to))
+
+	if isDir {
+		n := 0
+		err := filepath.Walk(oldTarget, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			if filepath.Ext(p) == ".strm" {
+				n++
+				return removeFile(p, opts.DryRun, traceID)
+			}
+			rel, _ := filepath.Rel(oldTarget, p)
+			return moveFile(p, filepath.Join(newTarget, rel), opts.DryRun, traceID)
+		})
+		if err != nil {
+			return oldTarget, n, err
+		}
+		if !opts.DryRun {
+			if err := os.RemoveAll(oldTarget); err != nil {
+				return oldTarget, n, err
+			}
+		}
+		return oldTarget, n, nil
+	}
+	if keep, err := g.keepTarget(ctx, opts, from, traceID); keep || err != nil {
+		return oldTarget, 0, err
+	}
+
+	oldBase := strings.TrimSuffix(filepath.Base(oldTarget), ".strm")
+	newBase := strings.TrimSuffix(filepath.Base(newTarget), filepath.Ext(newTarget))
+	n := 0
+	for _, f := range sidecars(oldTarget) {
+		if filepath.Ext(f) == ".strm" {
+			n++
+			if err := removeFile(f, opts.DryRun, traceID); err != nil {
+				return oldTarget, n, err
+			}
+			continue
+		}
+		name := newBase + strings.TrimPrefix(filepath.Base(f), oldBase)
+		if err := moveFile(f, filepath.Join(filepath.Dir(newTarget), name), opts.DryRun, traceID); err != nil {
+			return oldTarget, n, err
+		}
+	}
+	return oldTarget, n, nil
+}
+
+// sourceTarget returns the target of source path p: its target directory
+// when one exists, otherwise the STRM file of a video file
+func sourceTarget(opts GenerateOptions, p string) (string, bool) {
+	target := filepath.Join(opts.TargetPath, relSourcePath(opts.SourcePath, p))
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return target, true
+	}
+	return changeExtension(target, ".strm"), false
+}
+
+// keepTarget reports whether the targets of the removed source file p must
+// be kept: p is not a video of the mapping, or another video with the same
+// base name is still listed in its Alist directory. When p was the
+// duplicate the priority rule selected, the STRM file is written again for
+// the best remaining one, so it does not refer to a missing file.
+func (g *Generator) keepTarget(ctx context.Context, opts GenerateOptions, p, traceID string) (bool, error) {
+	removed := alist.FileItem{Name: path.Base(p)}
+	if !removed.IsVideo(opts.Extensions) {
+		log.Printf("[TraceID: %s] %s is not a video file, targets kept", traceID, p)
+		return true, nil
+	}
+
+	files, err := g.alistClient.ListFiles(ctx, path.Dir(p))
+	if errors.Is(err, alist.ErrNotFound) {
+		// The directory went away together with the file
+		return false, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("failed to list %s: %w", path.Dir(p), err)
+	}
+
+	// Best remaining duplicate, chosen like deduplicateFilesByPriority
+	base := strings.TrimSuffix(removed.Name, path.Ext(removed.Name))
+	var best *alist.FileItem
+	for i, f := range files {
+		if f.Name == removed.Name || !f.IsVideo(opts.Extensions) || strings.TrimSuffix(f.Name, path.Ext(f.Name)) != base {
+			continue
+		}
+		if best == nil || getExtensionPriority(path.Ext(f.Name)) < getExtensionPriority(path.Ext(best.Name)) {
+			best = &files[i]
+		}
+	}
+	if best == nil {
+		return false, nil
+	}
+
+	// On equal priority either file may have been selected
+	if getExtensionPriority(path.Ext(removed.Name)) > getExtensionPriority(path.Ext(best.Name)) {
+		log.Printf("[TraceID: %s] %s is still listed, targets of %s kept", traceID, best.Name, p)
+		return true, nil
+	}
+	survivor := *best
+	survivor.Path = path.Join(path.Dir(p), survivor.Name)
+	regen := opts
+	regen.Mode = "full"
+	if _, err := g.generateSTRMFile(ctx, survivor, regen, traceID); err != nil {
+		return true, err
+	}
+	log.Printf("[TraceID: %s] 🔁 REGENERATED: STRM of %s now refers to %s", traceID, p, survivor.Path)
+	return true, nil
+}
+
+// relSourcePath returns p relative to the source path
+func relSourcePath(source, p string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path.Clean(p), path.Clean(source)), "/")
+}
+
+// sidecars returns strmPath and the existing files next to it that belong
+// to the same video: same base name followed by "." or "-", unless a longer
+// base name with its own STRM file claims them (Movie-Extended.nfo belongs
+// to Movie-Extended.strm, not Movie.strm)
+func sidecars(strmPath string) []string {
+	dir := filepath.Dir(strmPath)
+	base := strings.TrimSuffix(filepath.Base(strmPath), ".strm")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var others []string
+	for _, entry := range entries {
+		other := strings.TrimSuffix(entry.Name(), ".strm")
+		if !entry.IsDir() && other != entry.Name() && len(other) > len(base) && strings.HasPrefix(other, base) {
+			others = append(others, other)
+		}
+	}
+	claimed := func(name string) bool {
+		for _, other := range others {
+			if strings.HasPrefix(name, other) && strings.ContainsAny(name[len(other):][:1], ".-") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base) {
+			continue
+		}
+		rest := name[len(base):]
+		if rest == ".strm" || (filepath.Ext(name) != ".strm" && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "-")) && !claimed(name)) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// removeTree removes a target directory and returns the number of STRM
+// files it contained
+func removeTree(dir string, dryRun bool, traceID string) (int, error) {
+	n := 0
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(p) == ".strm" {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if dryRun {
+		log.Printf("[TraceID: %s] 📝 WOULD DELETE: %s (%d STRM files)", traceID, dir, n)
+		return n, nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, fmt.Errorf("failed to remove %s: %w", dir, err)
+	}
+	log.Printf("[TraceID: %s] 🗑️  DELETED: %s (%d STRM files)", traceID, dir, n)
+	return n, nil
+}
+
+// removeFile removes a single target file
+func removeFile(p string, dryRun bool, traceID string) error {
+	if dryRun {
+		log.Printf("[TraceID: %s] 📝 WOULD DELETE: %s", traceID, p)
+		return nil
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", p, err)
+	}
+	log.Printf("[TraceID: %s] 🗑️  DELETED: %s", traceID, p)
+	return nil
+}
+
+// moveFile moves a target file, creating the destination directory
+func moveFile(from, to string, dryRun bool, traceID string) error {
+	if dryRun {
+		log.Printf("[TraceID: %s] 📝 WOULD MOVE: %s -> %s", traceID, from, to)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move %s: %w", from, err)
+	}
+	log.Printf("[TraceID: %s] 🚚 MOVED: %s -> %s", traceID, from, to)
+	return nil
+}
@@ -0,0 +1,147 @@
+package strm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+)
+
+// writeTargets creates empty files below dir
+func writeTargets(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles returns all files below dir relative to dir
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walk target: %v", err)
+	}
+	return out
+}
+
+func TestRemoveSource(t *testing.T) {
+	target := t.TempDir()
+	writeTargets(t, target, "Movie.strm", "Movie.nfo", "Movie-poster.jpg", "Movie 2.strm", "show/e01.strm", "show/e01.nfo", "show/e02.strm")
+	opts := GenerateOptions{SourcePath: "/media", TargetPath: target, Extensions: []string{"mkv", "mp4"}}
+	g := NewGenerator(&fakeAlist{tree: map[string][]alist.FileItem{"/media": {{Name: "Movie 2.mkv"}}}})
+	ctx := context.Background()
+
+	if _, n, err := g.RemoveSource(ctx, opts, "/media/Movie.mkv", "test"); err != nil || n != 1 {
+		t.Fatalf("RemoveSource(file) = %d, %v; want 1 STRM removed", n, err)
+	}
+	if _, n, err := g.RemoveSource(ctx, opts, "/media/show", "test"); err != nil || n != 2 {
+		t.Fatalf("RemoveSource(dir) = %d, %v; want 2 STRMs removed", n, err)
+	}
+	if got := fmt.Sprint(listFiles(t, target)); got != "[Movie 2.strm]" {
+		t.Errorf("remaining files = %s, want [Movie 2.strm]", got)
+	}
+
+	if _, _, err := g.RemoveSource(ctx, opts, "/media", "test"); err == nil {
+		t.Error("expected removing the source itself to be refused")
+	}
+}
+
+func TestRemoveSource_KeepsTargetsOfOtherFiles(t *testing.T) {
+	target := t.TempDir()
+	writeTargets(t, target, "Movie.strm", "Movie.nfo", "Movie-poster.jpg",
+		"Movie-Extended.strm", "Movie-Extended.nfo", "Movie-Extended-poster.jpg", "Other.strm")
+	opts := GenerateOptions{SourcePath: "/media", TargetPath: target, Extensions: []string{"mkv", "mp4"}}
+	client := &fakeAlist{tree: map[string][]alist.FileItem{
+		"/media": {{Name: "Movie.mkv"}, {Name: "Movie.srt"}, {Name: "Movie-Extended.mkv"}, {Name: "Other.mkv"}},
+	}}
+	g := NewGenerator(client)
+	ctx := context.Background()
+
+	// A subtitle is not a video: nothing of Movie goes
+	if _, n, err := g.RemoveSource(ctx, opts, "/media/Movie.srt", "test"); err != nil || n != 0 {
+		t.Fatalf("RemoveSource(subtitle) = %d, %v; want nothing removed", n, err)
+	}
+	// Movie.mkv is still listed next to the deleted duplicate
+	if _, n, err := g.RemoveSource(ctx, opts, "/media/Movie.mp4", "test"); err != nil || n != 0 {
+		t.Fatalf("RemoveSource(duplicate) = %d, %v; want nothing removed", n, err)
+	}
+	if _, n, err := g.MoveSource(ctx, opts, "/media/Movie.mp4", "/media/new/Film.mp4", "test"); err != nil || n != 0 {
+		t.Fatalf("MoveSource(duplicate) = %d, %v; want nothing removed", n, err)
+	}
+
+	// Movie.strm refers to the selected Movie.mkv, never to the duplicates
+	if got, _ := os.ReadFile(filepath.Join(target, "Movie.strm")); len(got) != 0 {
+		t.Errorf("Movie.strm = %q, want it unchanged", got)
+	}
+
+	// Once Movie.mkv is gone too, only its own files are removed
+	client.tree["/media"] = []alist.FileItem{{Name: "Movie-Extended.mkv"}, {Name: "Other.mkv"}}
+	if _, n, err := g.RemoveSource(ctx, opts, "/media/Movie.mkv", "test"); err != nil || n != 1 {
+		t.Fatalf("RemoveSource(file) = %d, %v; want 1 STRM removed", n, err)
+	}
+	want := "[Movie-Extended-poster.jpg Movie-Extended.nfo Movie-Extended.strm Other.strm]"
+	if got := fmt.Sprint(listFiles(t, target)); got != want {
+		t.Errorf("remaining files = %s, want %s", got, want)
+	}
+}
+
+func TestMoveSource(t *testing.T) {
+	target := t.TempDir()
+	writeTargets(t, target, "old/Movie.strm", "old/Movie.nfo", "old/Movie.zh.srt", "show/e01.strm", "show/fanart.jpg")
+	opts := GenerateOptions{SourcePath: "/media", TargetPath: target, Extensions: []string{"mkv"}}
+	g := NewGenerator(&fakeAlist{tree: map[string][]alist.FileItem{"/media/old": {}}})
+	ctx := context.Background()
+
+	if _, n, err := g.MoveSource(ctx, opts, "/media/old/Movie.mkv", "/media/new/Film.mkv", "test"); err != nil || n != 1 {
+		t.Fatalf("MoveSource(file) = %d, %v; want 1 STRM removed", n, err)
+	}
+	if _, n, err := g.MoveSource(ctx, opts, "/media/show", "/media/series/show", "test"); err != nil || n != 1 {
+		t.Fatalf("MoveSource(dir) = %d, %v; want 1 STRM removed", n, err)
+	}
+
+	want := "[new/Film.nfo new/Film.zh.srt series/show/fanart.jpg]"
+	if got := fmt.Sprint(listFiles(t, target)); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+}
+
+func TestRemoveSource_RegeneratesFromRemainingDuplicate(t *testing.T) {
+	target := t.TempDir()
+	writeTargets(t, target, "Movie.nfo")
+	if err := os.WriteFile(filepath.Join(target, "Movie.strm"), []byte("/media/Movie.mkv"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := GenerateOptions{SourcePath: "/media", TargetPath: target, Extensions: []string{"mkv", "mp4", "avi"}, STRMMode: "alist_path"}
+	g := NewGenerator(&fakeAlist{tree: map[string][]alist.FileItem{
+		"/media": {{Name: "Movie.avi"}, {Name: "Movie.mp4"}},
+	}})
+
+	// The selected Movie.mkv is deleted: the STRM now refers to Movie.mp4
+	if _, n, err := g.RemoveSource(context.Background(), opts, "/media/Movie.mkv", "test"); err != nil || n != 0 {
+		t.Fatalf("RemoveSource(selected duplicate) = %d, %v; want nothing removed", n, err)
+	}
+	got, err := os.ReadFile(filepath.Join(target, "Movie.strm"))
+	if err != nil || string(got) != "/media/Movie.mp4" {
+		t.Errorf("Movie.strm = %q, %v; want /media/Movie.mp4", got, err)
+	}
+	if files := fmt.Sprint(listFiles(t, target)); files != "[Movie.nfo Movie.strm]" {
+		t.Errorf("files = %s, want [Movie.nfo Movie.strm]", files)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/konghanghang/openlist-strm/internal/alist"
 	"github.com/konghanghang/openlist-strm/internal/contextkeys"
@@ -16,7 +18,8 @@ import (
 // AlistClient is an interface for Alist operations
 type AlistClient interface {
 	Ping(ctx context.Context) error
-	ListFilesRecursive(ctx context.Context, dirPath string, extensions []string) ([]alist.FileItem, error)
+	WalkFiles(ctx context.Context, dirPath string, opts alist.WalkOptions, fn func(dir string, files []alist.FileItem) error) error
+	ListFiles(ctx context.Context, dirPath string) ([]alist.FileItem, error)
 	GetFileURL(ctx context.Context, filePath string) (string, error)
 }
 
@@ -40,6 +43,37 @@ type GenerateOptions struct {
 	Concurrent int    // concurrent for this task
 	Mode       string // incremental or full
 	STRMMode   string // alist_path or http_url
+	DryRun     bool   // count what would change without touching the target
+
+	// Subpaths, if set, limits the run to these directories or files below
+	// SourcePath (absolute Alist paths). Full mode then only cleans the
+	// targets of the listed directories.
+	Subpaths []string
+
+	// DirCache, if set, lets the scan reuse stored listings of unchanged directories
+	DirCache alist.DirCache
+
+	// Discovery selects how files are found: "list" (default) walks every
+	// directory, "search" uses Alist's search index and falls back to listing
+	Discovery   string
+	IndexMaxAge time.Duration // maximum search index age for "search" discovery
+
+	// Refresh, if set, selects directories listed with Alist's cache bypassed
+	Refresh func(dir string) bool
+
+	// OnProgress, if set, is called with a snapshot of the counters (without
+	// Errors) after every processed file. Calls are serialized.
+	OnProgress func(progress GenerateResult)
+
+	// Checkpoint, if set, receives every finished directory and lets a
+	// resumed run skip directories finished by the run it resumes
+	Checkpoint Checkpoint
+}
+
+// queuedFile is a file sent to the writers with the directory it was walked in
+type queuedFile struct {
+	dir  string
+	file alist.FileItem
 }
 
 // GenerateResult represents the result of generation
@@ -48,9 +82,20 @@ type GenerateResult struct {
 	FilesDeleted int
 	FilesSkipped int
 	Errors       []error
+
+	// FailedPaths are the Alist paths of the files whose STRM could not be
+	// written, one per entry of Errors
+	FailedPaths []string
+
+	// Targets are the target directories and STRM files the run covered:
+	// TargetPath, or one entry per resolved subpath
+	Targets []string
 }
 
 // Generate generates STRM files for a directory
+// Files are streamed from the directory walk to the writers as each directory
+// is listed, so STRM files appear while the scan is still in progress and only
+// a bounded number of listed files is held in memory at any time.
 func (g *Generator) Generate(ctx context.Context, opts GenerateOptions) (*GenerateResult, error) {
 	// Extract trace ID from context if available
 	traceID := getTraceID(ctx)
@@ -59,31 +104,40 @@ func (g *Generator) Generate(ctx context.Context, opts GenerateOptions) (*Genera
 		Errors: []error{},
 	}
 
-	// Create target directory if not exists
-	if err := os.MkdirAll(opts.TargetPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	if opts.DryRun {
+		log.Printf("[TraceID: %s] Dry run: no files will be written or removed", traceID)
 	}
 
-	// Full mode: clean target directory
-	if opts.Mode == "full" {
-		log.Printf("[TraceID: %s] Cleaning target directory: %s", traceID, opts.TargetPath)
-		if err := cleanDirectory(opts.TargetPath); err != nil {
-			return nil, fmt.Errorf("failed to clean directory: %w", err)
+	// Create target directory if not exists
+	if !opts.DryRun {
+		if err := os.MkdirAll(opts.TargetPath, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create target directory: %w", err)
 		}
 	}
 
-	// List all video files from Alist
-	log.Printf("[TraceID: %s] Scanning source directory: %s", traceID, opts.SourcePath)
-	files, err := g.alistClient.ListFilesRecursive(ctx, opts.SourcePath, opts.Extensions)
+	// Resolve the part of the source tree this run covers
+	scopes, err := g.resolveScopes(ctx, opts, traceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+		return nil, fmt.Errorf("failed to resolve subpaths: %w", err)
+	}
+	for _, sc := range scopes {
+		result.Targets = append(result.Targets, sc.target)
 	}
 
-	log.Printf("[TraceID: %s] Found %d video files to process", traceID, len(files))
-
-	// Deduplicate files by priority (when same filename with different extensions)
-	files = deduplicateFilesByPriority(files, traceID)
-	log.Printf("[TraceID: %s] After deduplication: %d files to process", traceID, len(files))
+	// Full mode: clean target directory (single files are simply overwritten)
+	for _, sc := range scopes {
+		if opts.Mode != "full" || sc.dir == "" {
+			continue
+		}
+		if opts.DryRun {
+			log.Printf("[TraceID: %s] Dry run: would clean target directory: %s", traceID, sc.target)
+			continue
+		}
+		log.Printf("[TraceID: %s] Cleaning target directory: %s", traceID, sc.target)
+		if err := cleanDirectory(sc.target); err != nil {
+			return nil, fmt.Errorf("failed to clean directory: %w", err)
+		}
+	}
 
 	// Validate concurrent value
 	concurrent := opts.Concurrent
@@ -91,51 +145,156 @@ func (g *Generator) Generate(ctx context.Context, opts GenerateOptions) (*Genera
 		concurrent = 10 // Default to 10
 	}
 
-	// Generate STRM files concurrently
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, concurrent)
+	// Writers consume files from a bounded channel; a full channel blocks the
+	// directory walk, which keeps memory usage independent of library size
+	files := make(chan queuedFile, concurrent*2)
 	mu := &sync.Mutex{}
+	var wg sync.WaitGroup
 
-	for _, file := range files {
-		select {
-		case <-ctx.Done():
-			return result, ctx.Err()
-		default:
-		}
+	var tracker *dirTracker
+	if opts.Checkpoint != nil {
+		tracker = newDirTracker(opts.Checkpoint)
+	}
 
+	for i := 0; i < concurrent; i++ {
 		wg.Add(1)
-		sem <- struct{}{} // Acquire semaphore
-
-		go func(f alist.FileItem) {
+		go func() {
 			defer wg.Done()
-			defer func() { <-sem }() // Release semaphore
-
-			// Generate STRM file
-			created, err := g.generateSTRMFile(ctx, f, opts, traceID)
-			if err != nil {
-				mu.Lock()
-				result.Errors = append(result.Errors, err)
-				mu.Unlock()
-				log.Printf("[TraceID: %s] ❌ ERROR: %s -> %v", traceID, f.Path, err)
-			} else if created {
-				mu.Lock()
-				result.FilesCreated++
-				mu.Unlock()
-				log.Printf("[TraceID: %s] ✅ CREATED: %s", traceID, f.Path)
-			} else {
-				mu.Lock()
-				result.FilesSkipped++
-				mu.Unlock()
-				log.Printf("[TraceID: %s] ⏭️  SKIPPED: %s (already exists)", traceID, f.Path)
+			for f := range files {
+				// Drain remaining files without processing once cancelled
+				ok := false
+				if ctx.Err() == nil {
+					ok = g.processFile(ctx, f.file, opts, traceID, result, mu)
+				}
+				if tracker != nil {
+					tracker.handled(f.dir, ok)
+				}
 			}
-		}(file)
+		}()
 	}
 
+	// List video files from Alist and feed them to the writers
+	var found, queued int64
+	walkOpts := alist.WalkOptions{
+		Extensions:  opts.Extensions,
+		Cache:       opts.DirCache,
+		Refresh:     opts.Refresh,
+		UseSearch:   opts.Discovery == "search",
+		MaxIndexAge: opts.IndexMaxAge,
+		OnSearchFallback: func(reason error) {
+			log.Printf("[TraceID: %s] Search index not usable, falling back to directory listing: %v", traceID, reason)
+		},
+	}
+	var resumed int64
+	if tracker != nil {
+		walkOpts.Skip = func(dir string) bool {
+			if opts.Checkpoint.SubtreeDone(dir) {
+				log.Printf("[TraceID: %s] Resume: skipping finished directory tree %s", traceID, dir)
+				return true
+			}
+			return false
+		}
+		walkOpts.OnDir = tracker.walked
+	}
+	feed := func(dir string, batch []alist.FileItem) error {
+		atomic.AddInt64(&found, int64(len(batch)))
+
+		// Files of directories finished before a resume were already handled
+		if tracker != nil && opts.Checkpoint.DirDone(dir) {
+			atomic.AddInt64(&resumed, int64(len(batch)))
+			return nil
+		}
+
+		// Deduplicate files by priority (when same filename with different extensions)
+		// Duplicates always share a directory, so per-directory dedup is sufficient
+		batch = deduplicateFilesByPriority(batch, traceID)
+		atomic.AddInt64(&queued, int64(len(batch)))
+		if tracker != nil {
+			tracker.queued(dir, len(batch))
+		}
+
+		for i, f := range batch {
+			select {
+			case files <- queuedFile{dir: dir, file: f}:
+			case <-ctx.Done():
+				if tracker != nil {
+					// Unsent files can never be handled
+					for range batch[i:] {
+						tracker.handled(dir, false)
+					}
+				}
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	var walkErr error
+	for _, sc := range scopes {
+		if sc.dir == "" {
+			// A single file was listed with its siblings while resolving
+			log.Printf("[TraceID: %s] Generating single file: %s", traceID, sc.files[0].Path)
+			walkErr = feed(sc.parent, sc.files)
+		} else {
+			log.Printf("[TraceID: %s] Scanning source directory: %s", traceID, sc.dir)
+			walkErr = g.alistClient.WalkFiles(ctx, sc.dir, walkOpts, feed)
+		}
+		if walkErr != nil {
+			break
+		}
+	}
+
+	close(files)
 	wg.Wait()
 
+	log.Printf("[TraceID: %s] Scan finished: found %d video files, %d after deduplication",
+		traceID, atomic.LoadInt64(&found), atomic.LoadInt64(&queued))
+	if n := atomic.LoadInt64(&resumed); n > 0 {
+		log.Printf("[TraceID: %s] Resume: %d files in finished directories were not processed again", traceID, n)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if walkErr != nil {
+		return result, fmt.Errorf("failed to list files: %w", walkErr)
+	}
+
 	return result, nil
 }
 
+// processFile generates the STRM file for f and records the outcome in
+// result, reporting whether the file was handled without error
+func (g *Generator) processFile(ctx context.Context, f alist.FileItem, opts GenerateOptions, traceID string, result *GenerateResult, mu *sync.Mutex) bool {
+	created, err := g.generateSTRMFile(ctx, f, opts, traceID)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+		result.FailedPaths = append(result.FailedPaths, f.Path)
+		log.Printf("[TraceID: %s] ❌ ERROR: %s -> %v", traceID, f.Path, err)
+	} else if created && opts.DryRun {
+		result.FilesCreated++
+		log.Printf("[TraceID: %s] 📝 WOULD CREATE: %s", traceID, f.Path)
+	} else if created {
+		result.FilesCreated++
+		log.Printf("[TraceID: %s] ✅ CREATED: %s", traceID, f.Path)
+	} else {
+		result.FilesSkipped++
+		log.Printf("[TraceID: %s] ⏭️  SKIPPED: %s (already exists)", traceID, f.Path)
+	}
+
+	if opts.OnProgress != nil {
+		progress := *result
+		progress.Errors = nil
+		progress.FailedPaths = nil
+		opts.OnProgress(progress)
+	}
+	return err == nil
+}
+
 // generateSTRMFile generates a single STRM file
 // Returns (created, error) where created is true if a new file was created
 func (g *Generator) generateSTRMFile(ctx context.Context, file alist.FileItem, opts GenerateOptions, traceID string) (bool, error) {
@@ -147,12 +306,6 @@ func (g *Generator) generateSTRMFile(ctx context.Context, file alist.FileItem, o
 	strmPath := filepath.Join(opts.TargetPath, relPath)
 	strmPath = changeExtension(strmPath, ".strm")
 
-	// Create parent directory
-	parentDir := filepath.Dir(strmPath)
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		return false, fmt.Errorf("failed to create directory %s: %w", parentDir, err)
-	}
-
 	// Check if STRM file already exists (for incremental mode)
 	if opts.Mode == "incremental" {
 		if _, err := os.Stat(strmPath); err == nil {
@@ -160,6 +313,15 @@ func (g *Generator) generateSTRMFile(ctx context.Context, file alist.FileItem, o
 			return false, nil
 		}
 	}
+	if opts.DryRun {
+		return true, nil
+	}
+
+	// Create parent directory
+	parentDir := filepath.Dir(strmPath)
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory %s: %w", parentDir, err)
+	}
 
 	// Determine STRM file content based on mode
 	var strmContent string
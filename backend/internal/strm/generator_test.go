@@ -0,0 +1,295 @@
+package strm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+)
+
+// fakeAlist serves a static tree of directory listings
+type fakeAlist struct {
+	tree    map[string][]alist.FileItem
+	walkErr error
+}
+
+func (f *fakeAlist) Ping(ctx context.Context) error { return nil }
+
+func (f *fakeAlist) WalkFiles(ctx context.Context, dirPath string, opts alist.WalkOptions, fn func(dir string, files []alist.FileItem) error) error {
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if opts.Skip != nil && opts.Skip(dir) {
+			return nil
+		}
+		var files []alist.FileItem
+		subdirs := []string{}
+		for _, item := range f.tree[dir] {
+			if item.IsDir {
+				subdirs = append(subdirs, path.Join(dir, item.Name))
+				if err := walk(path.Join(dir, item.Name)); err != nil {
+					return err
+				}
+			} else if item.IsVideo(opts.Extensions) {
+				item.Path = path.Join(dir, item.Name)
+				files = append(files, item)
+			}
+		}
+		if len(files) > 0 {
+			if err := fn(dir, files); err != nil {
+				return err
+			}
+		}
+		if opts.OnDir != nil {
+			opts.OnDir(dir, subdirs)
+		}
+		return nil
+	}
+	if err := walk(dirPath); err != nil {
+		return err
+	}
+	return f.walkErr
+}
+
+func (f *fakeAlist) ListFiles(ctx context.Context, dirPath string) ([]alist.FileItem, error) {
+	files, ok := f.tree[dirPath]
+	if !ok {
+		return nil, &alist.APIError{Code: 500, Message: "object not found"}
+	}
+	return files, nil
+}
+
+func (f *fakeAlist) GetFileURL(ctx context.Context, filePath string) (string, error) {
+	return "http://alist.local/d" + filePath, nil
+}
+
+// listSTRMs returns the STRM files below dir relative to dir
+func listSTRMs(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(p) == ".strm" {
+			rel, _ := filepath.Rel(dir, p)
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk target: %v", err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestGenerate_StreamsAndDeduplicates(t *testing.T) {
+	client := &fakeAlist{tree: map[string][]alist.FileItem{
+		"/media":      {{Name: "a.mp4"}, {Name: "show", IsDir: true}},
+		"/media/show": {{Name: "e01.mp4"}, {Name: "e01.mkv"}, {Name: "e02.mp4"}},
+	}}
+	target := t.TempDir()
+
+	var progressCalls int
+	result, err := NewGenerator(client).Generate(context.Background(), GenerateOptions{
+		SourcePath: "/media",
+		TargetPath: target,
+		Extensions: []string{"mp4", "mkv"},
+		Concurrent: 2,
+		Mode:       "incremental",
+		STRMMode:   "alist_path",
+		OnProgress: func(GenerateResult) { progressCalls++ },
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if result.FilesCreated != 3 {
+		t.Errorf("FilesCreated = %v, want 3", result.FilesCreated)
+	}
+	if progressCalls != 3 {
+		t.Errorf("progress calls = %v, want 3", progressCalls)
+	}
+
+	want := []string{"a.strm", "show/e01.strm", "show/e02.strm"}
+	got := listSTRMs(t, target)
+	if len(got) != len(want) {
+		t.Fatalf("STRM files = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("STRM files = %v, want %v", got, want)
+			break
+		}
+	}
+
+	content, _ := os.ReadFile(filepath.Join(target, "show", "e01.strm"))
+	if string(content) != "/media/show/e01.mkv" {
+		t.Errorf("e01.strm content = %q, want the mkv path", content)
+	}
+}
+
+func TestGenerate_WalkErrorKeepsPartialResult(t *testing.T) {
+	client := &fakeAlist{
+		tree:    map[string][]alist.FileItem{"/media": {{Name: "a.mp4"}}},
+		walkErr: errors.New("alist unavailable"),
+	}
+
+	result, err := NewGenerator(client).Generate(context.Background(), GenerateOptions{
+		SourcePath: "/media",
+		TargetPath: t.TempDir(),
+		Extensions: []string{"mp4"},
+		Mode:       "incremental",
+		STRMMode:   "http_url",
+	})
+	if err == nil {
+		t.Fatal("Generate() expected error when the walk fails, got nil")
+	}
+	if result == nil || result.FilesCreated != 1 {
+		t.Errorf("result = %+v, want the file written before the failure to be counted", result)
+	}
+}
+
+// memoryCheckpoint is an in-memory Checkpoint for tests
+type memoryCheckpoint struct {
+	mu      sync.Mutex
+	earlier map[string]bool // directories finished by an earlier attempt
+	marked  map[string][]string
+}
+
+func (m *memoryCheckpoint) DirDone(dir string) bool     { return m.earlier[dir] }
+func (m *memoryCheckpoint) SubtreeDone(dir string) bool { return m.earlier[dir] && dir != "/media" }
+func (m *memoryCheckpoint) MarkDir(dir string, subdirs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.marked[dir] = subdirs
+}
+
+func TestGenerate_CheckpointsAndResumes(t *testing.T) {
+	client := &fakeAlist{tree: map[string][]alist.FileItem{
+		"/media":      {{Name: "a.mp4"}, {Name: "done", IsDir: true}, {Name: "todo", IsDir: true}},
+		"/media/done": {{Name: "old.mp4"}},
+		"/media/todo": {{Name: "new.mp4"}},
+	}}
+	target := t.TempDir()
+
+	// /media itself was finished, but its subtree was not
+	cp := &memoryCheckpoint{
+		earlier: map[string]bool{"/media": true, "/media/done": true},
+		marked:  make(map[string][]string),
+	}
+	result, err := NewGenerator(client).Generate(context.Background(), GenerateOptions{
+		SourcePath: "/media",
+		TargetPath: target,
+		Extensions: []string{"mp4"},
+		Mode:       "incremental",
+		STRMMode:   "alist_path",
+		Checkpoint: cp,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if got := listSTRMs(t, target); len(got) != 1 || got[0] != "todo/new.strm" {
+		t.Fatalf("expected only the unfinished directory to be generated, got %v", got)
+	}
+	if result.FilesCreated != 1 {
+		t.Errorf("expected 1 created file, got %d", result.FilesCreated)
+	}
+	if _, ok := cp.marked["/media/todo"]; !ok {
+		t.Error("expected finished directory to be checkpointed")
+	}
+	if got := cp.marked["/media"]; len(got) != 2 {
+		t.Errorf("expected /media to be checkpointed with its subdirs, got %v", got)
+	}
+	if _, ok := cp.marked["/media/done"]; ok {
+		t.Error("skipped subtree should not be walked")
+	}
+}
+
+func TestGenerate_DryRun(t *testing.T) {
+	client := &fakeAlist{tree: map[string][]alist.FileItem{
+		"/media":      {{Name: "a.mp4"}, {Name: "show", IsDir: true}},
+		"/media/show": {{Name: "e01.mp4"}},
+	}}
+	target := t.TempDir()
+	existing := filepath.Join(target, "keep.strm")
+	if err := os.WriteFile(existing, []byte("/media/keep.mp4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewGenerator(client).Generate(context.Background(), GenerateOptions{
+		SourcePath: "/media",
+		TargetPath: target,
+		Extensions: []string{"mp4"},
+		Mode:       "full",
+		STRMMode:   "http_url",
+		DryRun:     true,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if result.FilesCreated != 2 {
+		t.Errorf("expected 2 files reported as created, got %d", result.FilesCreated)
+	}
+	if got := listSTRMs(t, target); len(got) != 1 || got[0] != "keep.strm" {
+		t.Errorf("dry run must not touch the target, got %v", got)
+	}
+}
+
+func TestGenerate_Subpaths(t *testing.T) {
+	client := &fakeAlist{tree: map[string][]alist.FileItem{
+		"/media":          {{Name: "a.mp4"}, {Name: "b.mp4"}, {Name: "b.mkv"}, {Name: "show", IsDir: true}, {Name: "other", IsDir: true}},
+		"/media/show":     {{Name: "e01.mp4"}, {Name: "s01", IsDir: true}},
+		"/media/show/s01": {{Name: "e02.mp4"}},
+		"/media/other":    {{Name: "x.mp4"}},
+	}}
+	target := t.TempDir()
+
+	// Leftovers of the scoped directory are cleaned in full mode, others stay
+	for _, name := range []string{"show/stale.strm", "other/keep.strm"} {
+		p := filepath.Join(target, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := NewGenerator(client).Generate(context.Background(), GenerateOptions{
+		SourcePath: "/media",
+		TargetPath: target,
+		Extensions: []string{"mp4", "mkv"},
+		Mode:       "full",
+		STRMMode:   "alist_path",
+		Subpaths:   []string{"/media/show", "/media/b.mp4", "/media/gone.mp4"},
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	want := []string{"b.strm", "other/keep.strm", "show/e01.strm", "show/s01/e02.strm"}
+	if got := listSTRMs(t, target); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("STRM files = %v, want %v", got, want)
+	}
+	if result.FilesCreated != 3 {
+		t.Errorf("FilesCreated = %v, want 3", result.FilesCreated)
+	}
+	content, err := os.ReadFile(filepath.Join(target, "b.strm"))
+	if err != nil || string(content) != "/media/b.mkv" {
+		t.Errorf("b.strm = %q, %v; want the deduplicated /media/b.mkv", content, err)
+	}
+	wantTargets := []string{filepath.Join(target, "show"), filepath.Join(target, "b.strm")}
+	if fmt.Sprint(result.Targets) != fmt.Sprint(wantTargets) {
+		t.Errorf("Targets = %v, want %v", result.Targets, wantTargets)
+	}
+}
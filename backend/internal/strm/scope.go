@@ -0,0 +1,92 @@
+package strm
+
+import (
+	"context"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/konghanghang/openlist-strm/internal/alist"
+)
+
+// scope is a part of the source tree a run is limited to: either a
+// directory walked recursively or a single file with its same-named siblings
+type scope struct {
+	dir    string           // directory to walk; empty for a single file
+	parent string           // directory of a single file
+	files  []alist.FileItem // the file and its siblings differing only in extension
+	target string           // target directory or STRM file of the scope
+}
+
+// resolveScopes turns opts.Subpaths into scopes. Each subpath is looked up
+// in a listing of its parent directory, which tells directories from files
+// and provides the siblings needed to deduplicate a single file. Subpaths
+// that no longer exist are logged and skipped.
+func (g *Generator) resolveScopes(ctx context.Context, opts GenerateOptions, traceID string) ([]scope, error) {
+	source := path.Clean(opts.SourcePath)
+	if len(opts.Subpaths) == 0 {
+		return []scope{{dir: opts.SourcePath, target: opts.TargetPath}}, nil
+	}
+
+	var scopes []scope
+	for _, subpath := range opts.Subpaths {
+		subpath = path.Clean(subpath)
+		if subpath == source {
+			return []scope{{dir: opts.SourcePath, target: opts.TargetPath}}, nil
+		}
+		rel := strings.TrimPrefix(subpath, source+"/")
+		parent := path.Dir(subpath)
+
+		var (
+			files   []alist.FileItem
+			subdirs []string
+		)
+		walkOpts := alist.WalkOptions{
+			Extensions: opts.Extensions,
+			Refresh:    opts.Refresh,
+			Skip:       func(dir string) bool { return dir != parent },
+			OnDir:      func(dir string, sub []string) { subdirs = sub },
+		}
+		err := g.alistClient.WalkFiles(ctx, parent, walkOpts, func(dir string, batch []alist.FileItem) error {
+			files = batch
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if containsPath(subdirs, subpath) {
+			scopes = append(scopes, scope{dir: subpath, target: filepath.Join(opts.TargetPath, rel)})
+			continue
+		}
+
+		base := strings.TrimSuffix(subpath, path.Ext(subpath))
+		var siblings []alist.FileItem
+		for _, f := range files {
+			if strings.TrimSuffix(f.Path, path.Ext(f.Path)) == base {
+				siblings = append(siblings, f)
+			}
+		}
+		if len(siblings) == 0 {
+			log.Printf("[TraceID: %s] Subpath not found or not a video file, skipping: %s", traceID, subpath)
+			continue
+		}
+		scopes = append(scopes, scope{
+			parent: parent,
+			files:  siblings,
+			target: changeExtension(filepath.Join(opts.TargetPath, rel), ".strm"),
+		})
+	}
+	return scopes, nil
+}
+
+// containsPath reports whether paths contains p
+func containsPath(paths []string, p string) bool {
+	for _, candidate := range paths {
+		if candidate == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package strm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateResult represents the result of checking the STRM files of a target
+type ValidateResult struct {
+	FilesChecked int
+	Invalid      []error // one error per invalid STRM file
+}
+
+// Validate checks the STRM files below opts.TargetPath without contacting
+// Alist: a file must not be empty, and must hold the Alist path of its
+// source file (alist_path mode) or an http(s) URL (http_url mode). Only the
+// local target is read, so files removed from Alist are not detected.
+func Validate(ctx context.Context, opts GenerateOptions) (*ValidateResult, error) {
+	result := &ValidateResult{}
+	err := filepath.WalkDir(opts.TargetPath, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == opts.TargetPath {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".strm" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result.FilesChecked++
+		if err := validateSTRMFile(opts, p); err != nil {
+			result.Invalid = append(result.Invalid, fmt.Errorf("%s: %w", p, err))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// validateSTRMFile checks the content of a single STRM file
+func validateSTRMFile(opts GenerateOptions, p string) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return fmt.Errorf("empty STRM file")
+	}
+
+	if opts.STRMMode != "alist_path" {
+		u, err := url.Parse(content)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("not an http(s) URL: %s", content)
+		}
+		return nil
+	}
+
+	source := strings.TrimSuffix(path.Clean(opts.SourcePath), "/")
+	if !strings.HasPrefix(path.Clean(content), source+"/") {
+		return fmt.Errorf("path %s is outside source %s", content, opts.SourcePath)
+	}
+	want := changeExtension(filepath.Join(opts.TargetPath, relSourcePath(source, content)), ".strm")
+	if filepath.Clean(want) != filepath.Clean(p) {
+		return fmt.Errorf("path %s does not match the STRM file location", content)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package strm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	target := t.TempDir()
+	files := map[string]string{
+		"Movie/movie.strm":   "/alist/movies/Movie/movie.mkv",
+		"Movie/movie.nfo":    "",
+		"Show/e01.strm":      "/alist/movies/Show/e02.mkv",
+		"Show/e02.strm":      "",
+		"Other/outside.strm": "/alist/tv/outside.mkv",
+	}
+	for name, content := range files {
+		p := filepath.Join(target, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Validate(context.Background(), GenerateOptions{SourcePath: "/alist/movies", TargetPath: target, STRMMode: "alist_path"})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	var invalid []string
+	for _, e := range result.Invalid {
+		rel, _ := filepath.Rel(target, strings.SplitN(e.Error(), ": ", 2)[0])
+		invalid = append(invalid, filepath.ToSlash(rel))
+	}
+	if result.FilesChecked != 4 {
+		t.Errorf("checked = %d, want 4", result.FilesChecked)
+	}
+	if got, want := fmt.Sprint(invalid), "[Other/outside.strm Show/e01.strm Show/e02.strm]"; got != want {
+		t.Errorf("invalid = %s, want %s", got, want)
+	}
+}